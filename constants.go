@@ -6,6 +6,22 @@ const (
 	AgentID        = 9900099
 	AgentSecret    = "Oehy_cKht8qzQy2Mnju3213KlSBKNKQR8Q0-klzs43t"
 	EncodingAeskey = "2022m7qr5nMoAUwZRj2022mz3KA1tkAj3ykkR6q2022"
-	Token          = "5Q6v02m1ls7OVdi27Y3N" // 这里是回调URL的token，不是调用接口的access_token
-	UserID         = "user_abc"             // 测试用
+	Token          = "5Q6v02m1ls7OVdi27Y3N"             // 这里是回调URL的token，不是调用接口的access_token
+	UserID         = "user_abc"                         // 测试用
+	StoreFile      = "./data/store.json"                // 本地存储文件
+	BaseURL        = "https://wecom.example.com"        // 服务对外访问地址，用于拼接网页登录的回调地址
+	SessionSecret  = "q9K2mVx7LpT4wZr8NcY3bHd6FjS1aGe5" // 登录会话cookie的签名密钥
+	RelaySecret    = "Hs7Dk2Qw9Zm4Xv1Lp6Bt3Nf8Rc5Jy0Ga" // 业务系统调用转发接口的签名密钥
+	// 第三方应用
+	ProviderCorpID      = "wwd08c8e7c775ab44d"                          // 服务商的corpid
+	ProviderSecret      = "Jm4Xq7Vb2Nz9Lc1Hw6Rt3Ky8Pd5Gf0Sa2Ue7Mo4Ti9B" // 服务商的secret，在服务商管理后台获取
+	SuiteID             = "ww4asffe9xxx4c0f4c"                          // 第三方应用的suite_id
+	SuiteSecret         = "Vr9mRk1wQ2c8Zt5hYp3LxN7bGf0sJd4aUe6oKi2Tq8M" // 第三方应用的secret
+	SuiteToken          = "q3V8mPz1Rt6Ks9Wd"                            // 第三方应用指令回调的token
+	SuiteEncodingAeskey = "4fQk9Lm2Xp7Rz1Nc5Vb8Hd3Jt6Wg0Ys2Ue9Ka4Mo7Pi" // 第三方应用指令回调的EncodingAESKey
 )
+
+// 允许推送审批结果的webhook地址，按scheme://host匹配，发起审批时webhook_url不在其中会被拒绝
+var ApprovalWebhookOrigins = []string{
+	"https://ops.example.com",
+}
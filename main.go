@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -23,12 +26,77 @@ func setupRouter() *gin.Engine {
 		wecom.POST("", func(c *gin.Context) {
 			Callback(c)
 		})
+		// 转发发送消息
+		wecom.POST("/message/send", RelayAuthRequired(), func(c *gin.Context) {
+			RelaySendMsg(c)
+		})
+		// 撤回消息
+		wecom.POST("/message/recall", RelayAuthRequired(), func(c *gin.Context) {
+			RelayRecallMsg(c)
+		})
+		// 主动更新模板卡片
+		wecom.POST("/template_card/update", RelayAuthRequired(), func(c *gin.Context) {
+			RelayUpdateTemplateCard(c)
+		})
+		// 发起审批
+		wecom.POST("/approval", RelayAuthRequired(), func(c *gin.Context) {
+			RelayStartApproval(c)
+		})
+		// 查询审批
+		wecom.GET("/approval/:task_id", RelayAuthRequired(), func(c *gin.Context) {
+			RelayGetApproval(c)
+		})
+		// 企业微信内网页登录后获取当前成员
+		wecom.GET("/oauth/userinfo", OAuthRequired(OAuthScopeBase), func(c *gin.Context) {
+			GetCurrentUser(c)
+		})
+		// 浏览器扫码登录
+		wecom.GET("/sso/login", func(c *gin.Context) {
+			SSOLogin(c)
+		})
+		// 扫码登录回调
+		wecom.GET("/sso/callback", func(c *gin.Context) {
+			SSOCallback(c)
+		})
+		// 扫码登录后获取当前成员
+		wecom.GET("/sso/userinfo", SessionRequired(), func(c *gin.Context) {
+			GetCurrentUser(c)
+		})
+		// 获取JS-SDK签名配置
+		wecom.GET("/jssdk/config", func(c *gin.Context) {
+			RelayJSSDKConfig(c)
+		})
+		// 验证第三方应用指令回调URL
+		wecom.GET("/suite", func(c *gin.Context) {
+			VerifySuiteURL(c)
+		})
+		// 处理第三方应用指令回调
+		wecom.POST("/suite", func(c *gin.Context) {
+			SuiteCallback(c)
+		})
+		// 退出登录
+		wecom.POST("/logout", SameOriginRequired(), func(c *gin.Context) {
+			Logout(c)
+		})
 	}
 
 	return r
 }
 
 func main() {
+	// 初始化本地存储
+	fileStore, err := NewFileStore(StoreFile)
+	if err != nil {
+		fmt.Println("init file store err, use memory store: ", err)
+	} else {
+		Store = fileStore
+	}
+
+	// 定时处理过期审批
+	go RunApprovalExpiry(time.Minute)
+	// 加载通讯录缓存，每小时全量校准一次
+	go Contacts.Run(time.Hour)
+
 	r := setupRouter()
 	// // 测试发送消息到企业微信
 	// go func() {
@@ -3,7 +3,10 @@ package main
 import (
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func HttpPost(url string, contentType string, body io.Reader) (content []byte, err error) {
@@ -35,3 +38,51 @@ func HttpGet(url string) (content []byte, err error) {
 
 	return
 }
+
+// HttpPostMultipart
+// @Description: 以multipart/form-data上传单个文件，size为文件字节数，文件内容边读边发送
+func HttpPostMultipart(url string, fieldName string, fileName string, file io.Reader, size int64) (content []byte, err error) {
+	boundary := multipart.NewWriter(nil).Boundary()
+	fileName = strings.NewReplacer("\\", "\\\\", `"`, "\\\"").Replace(fileName)
+	// 企业微信要求文件part中带filelength
+	head := "--" + boundary + "\r\n" +
+		`Content-Disposition: form-data; name="` + fieldName + `"; filename="` + fileName + `"; filelength=` + strconv.FormatInt(size, 10) + "\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\n"
+	tail := "\r\n--" + boundary + "--\r\n"
+
+	req, err := http.NewRequest(http.MethodPost, url, io.MultiReader(strings.NewReader(head), io.LimitReader(file, size), strings.NewReader(tail)))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(head)) + size + int64(len(tail))
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+
+	content, err = ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// HttpGetRange
+// @Description: 发送带Range的GET请求，start小于0时不带Range，end小于0时读取到文件末尾；调用方负责关闭响应
+func HttpGetRange(url string, start int64, end int64) (r *http.Response, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if start >= 0 {
+		byteRange := "bytes=" + strconv.FormatInt(start, 10) + "-"
+		if end >= 0 {
+			byteRange += strconv.FormatInt(end, 10)
+		}
+		req.Header.Set("Range", byteRange)
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -1,4 +1,4 @@
 #!/bin/bash
 set -e
 
-go run main.go request.go response.go wecom.go constants.go wecom_test_send.go wecom_test_callback.go
\ No newline at end of file
+go run main.go request.go response.go wecom.go constants.go wecom_test_send.go wecom_test_callback.go wecom_message.go wecom_markdown.go wecom_store.go wecom_token.go wecom_outbound.go wecom_relay.go wecom_template_card.go wecom_approval.go wecom_user.go wecom_department.go wecom_tag.go wecom_directory.go wecom_media.go wecom_batch.go wecom_appchat.go wecom_ratelimit.go wecom_robot.go wecom_linkedcorp.go wecom_pager.go wecom_externalcontact.go wecom_externalcontact_event.go wecom_groupmsg.go wecom_session.go wecom_oauth.go wecom_sso.go wecom_jssdk.go wecom_suite.go wecom_provider.go wecom_kf.go wecom_oa.go wecom_checkin.go
\ No newline at end of file
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -8,7 +9,10 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"runtime/debug"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
@@ -22,18 +26,64 @@ type VerifyURLReq struct {
 	EchoStr      string `form:"echostr" json:"echostr" example:"P9nAzCzyDtyTWESHep1vC5X9xho/qYX3Zpb4yKa9SKld1DsH3Iyt3tP3zNdtp+4RPcs8TgAE7OaBO+FZXvnaqQ=="` // 加密的字符串
 }
 
+// 企业微信接口响应公共字段
+type CommonResp struct {
+	ErrCode int    `json:"errcode"` // 返回码
+	ErrMsg  string `json:"errmsg"`  // 对返回码的文本描述内容
+}
+
+// 企业微信接口响应，用于统一检查返回码
+type APIResp interface {
+	GetErr() error
+}
+
+// 返回码非0时返回*WecomError
+func (r *CommonResp) GetErr() error {
+	if r.ErrCode != 0 {
+		return &WecomError{ErrCode: r.ErrCode, ErrMsg: r.ErrMsg}
+	}
+	return nil
+}
+
+// 企业微信常用返回码
+const (
+	ErrCodeSystemBusy         = -1    // 系统繁忙，可稍后重试
+	ErrCodeInvalidAccessToken = 40014 // 不合法的access_token
+	ErrCodeAccessTokenExpired = 42001 // access_token已过期
+	ErrCodeAPIFreqOutOfLimit  = 45009 // 接口调用超过限制
+	ErrCodeUserNotFound       = 60111 // userid不存在
+	ErrCodeDepartmentNotFound = 60123 // 无效的部门id
+	ErrCodeInvalidChatID      = 86001 // 不合法的群聊id
+	ErrCodeAppChatNotFound    = 86003 // 群聊不存在
+)
+
+// 企业微信接口返回的错误
+type WecomError struct {
+	ErrCode int    // 返回码
+	ErrMsg  string // 对返回码的文本描述内容
+}
+
+func (e *WecomError) Error() string {
+	return strconv.Itoa(e.ErrCode) + e.ErrMsg
+}
+
+// IsErrCode
+// @Description: 判断err是否为指定返回码的企业微信接口错误
+func IsErrCode(err error, errCode int) bool {
+	var wecomErr *WecomError
+	return errors.As(err, &wecomErr) && wecomErr.ErrCode == errCode
+}
+
 // 获取token响应字段
 type GetTokenResp struct {
-	ErrCode     int    `json:"errcode"`      // 出错返回码
-	ErrMsg      string `json:"errmsg"`       // 返回码提示语
+	CommonResp
 	AccessToken string `json:"access_token"` // 获取到的凭证
 	ExpiresIn   int    `json:"expires_in"`   // 凭证的有效时间（秒）
 }
 
 // 发送消息企业微信响应字段
 type SendMsgResp struct {
-	ErrCode      int    `json:"errcode"`       // 返回码
-	ErrMsg       string `json:"errmsg"`        // 对返回码的文本描述内容
+	CommonResp
 	InvalidUser  string `json:"invaliduser"`   // 不合法的userid，不区分大小写，统一转为小写
 	InvalidParty string `json:"invalidparty"`  // 不合法的partyid
 	InvalidTag   string `json:"invalidtag"`    // 不合法的标签id
@@ -43,9 +93,8 @@ type SendMsgResp struct {
 
 // 获取服务器ip响应字段
 type GetIPResp struct {
-	ErrCode int      `json:"errcode"` // 错误码
-	ErrMsg  string   `json:"errmsg"`  // 错误信息
-	IPList  []string `json:"ip_list"` // 企业微信回调的IP段
+	CommonResp
+	IPList []string `json:"ip_list"` // 企业微信回调的IP段
 }
 
 // ***callback start***//
@@ -65,6 +114,22 @@ type CallbackMsgContentCommon struct {
 	AgentID      int    `xml:"AgentID"`      // 企业应用的id
 }
 
+// 企业微信回调事件消息解密后的公共字段
+type CallbackEventCommon struct {
+	CallbackMsgContentCommon
+	Event      string `xml:"Event"`      // 事件类型
+	ChangeType string `xml:"ChangeType"` // 变更类型，部分事件有
+}
+
+// 回调消息处理函数，返回http状态码和加密后的被动响应包
+type CallbackHandler func(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error)
+
+// 按事件类型注册的回调处理函数
+var eventHandlers = map[string]CallbackHandler{
+	// 测试回复更新模板卡片按钮交互文案
+	"template_card_event": CallbackTemplateCardButtonTest,
+}
+
 // ***callback end***//
 
 // GetToken
@@ -85,7 +150,7 @@ func GetToken(corpid, corpsecret string) (access_token string, err error) {
 	if getTokenResp.ErrCode != 0 {
 		errStr := strconv.Itoa(getTokenResp.ErrCode) + getTokenResp.ErrMsg
 		fmt.Println("get token from wecom err: ", errStr)
-		return "", errors.New(errStr)
+		return "", getTokenResp.GetErr()
 	}
 	access_token = getTokenResp.AccessToken
 	fmt.Println("get token from wecom success: ", access_token)
@@ -111,7 +176,7 @@ func SendMsg(access_token string, body io.Reader) (sendMsgResp *SendMsgResp, err
 	if sendMsgResp.ErrCode != 0 {
 		errStr := strconv.Itoa(sendMsgResp.ErrCode) + sendMsgResp.ErrMsg
 		fmt.Println("send message to wecom err: ", errStr)
-		return sendMsgResp, errors.New(errStr)
+		return sendMsgResp, sendMsgResp.GetErr()
 	}
 	fmt.Println("send message to wecom success: ", sendMsgResp)
 	return sendMsgResp, nil
@@ -135,12 +200,141 @@ func GetIP(access_token string) (ipList []string, err error) {
 	if getIPResp.ErrCode != 0 {
 		errStr := strconv.Itoa(getIPResp.ErrCode) + getIPResp.ErrMsg
 		fmt.Println("get ip from wecom err: ", errStr)
-		return nil, errors.New(errStr)
+		return nil, getIPResp.GetErr()
 	}
 	fmt.Println("get ip from wecom success: ", getIPResp.IPList)
 	return getIPResp.IPList, nil
 }
 
+// PostAPI
+// @Description: 以json格式调用企业微信POST接口并解析响应，path可带查询参数，
+// 返回token无效或过期时刷新缓存的凭证并重试一次
+func PostAPI(path string, access_token string, reqBody interface{}, resp APIResp) (err error) {
+	fmt.Println("post wecom api " + logPath(path) + "...")
+	reqJSON, err := json.Marshal(reqBody)
+	if err != nil {
+		fmt.Println("post wecom api "+logPath(path)+" json err: ", err)
+		return err
+	}
+	err = postAPI(path, access_token, reqJSON, resp)
+	if newPath, newToken, ok := refreshAPIToken(err, path, access_token); ok {
+		err = postAPI(newPath, newToken, reqJSON, resp)
+	}
+	return err
+}
+
+func postAPI(path string, access_token string, reqJSON []byte, resp APIResp) (err error) {
+	content, err := HttpPost(apiURL(path, access_token, nil), "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		err = redactURLErr(err)
+		fmt.Println("post wecom api "+logPath(path)+" err: ", err)
+		return err
+	}
+	return parseAPIResp(path, content, resp)
+}
+
+// GetAPI
+// @Description: 调用企业微信GET接口并解析响应，返回token无效或过期时刷新缓存的凭证并重试一次
+func GetAPI(path string, access_token string, params url.Values, resp APIResp) (err error) {
+	fmt.Println("get wecom api " + logPath(path) + "...")
+	err = getAPI(path, access_token, params, resp)
+	if newPath, newToken, ok := refreshAPIToken(err, path, access_token); ok {
+		err = getAPI(newPath, newToken, params, resp)
+	}
+	return err
+}
+
+func getAPI(path string, access_token string, params url.Values, resp APIResp) (err error) {
+	content, err := HttpGet(apiURL(path, access_token, params))
+	if err != nil {
+		err = redactURLErr(err)
+		fmt.Println("get wecom api "+logPath(path)+" err: ", err)
+		return err
+	}
+	return parseAPIResp(path, content, resp)
+}
+
+// 接口返回token无效或过期时刷新凭证，返回替换凭证后的path和access_token，
+// 凭证可能在access_token参数中，也可能在path的suite_access_token、provider_access_token参数中
+func refreshAPIToken(err error, path string, access_token string) (newPath string, newToken string, ok bool) {
+	if !IsErrCode(err, ErrCodeInvalidAccessToken) && !IsErrCode(err, ErrCodeAccessTokenExpired) {
+		return "", "", false
+	}
+	if access_token != "" {
+		newToken, ok = Tokens.Refresh(access_token)
+		return path, newToken, ok
+	}
+	i := strings.Index(path, "?")
+	if i < 0 {
+		return "", "", false
+	}
+	query, parseErr := url.ParseQuery(path[i+1:])
+	if parseErr != nil {
+		return "", "", false
+	}
+	for _, name := range []string{"suite_access_token", "provider_access_token", "access_token"} {
+		if token := query.Get(name); token != "" {
+			if newToken, ok = Tokens.Refresh(token); !ok {
+				return "", "", false
+			}
+			query.Set(name, newToken)
+			return path[:i+1] + query.Encode(), "", true
+		}
+	}
+	return "", "", false
+}
+
+// 日志中使用的接口路径，去掉路径上的参数，如suite_access_token、provider_access_token、机器人key
+func logPath(path string) string {
+	if i := strings.Index(path, "?"); i >= 0 {
+		return path[:i]
+	}
+	return path
+}
+
+// 去掉请求错误中接口地址的参数，避免access_token等凭证随错误打印或返回
+func redactURLErr(err error) error {
+	if e, ok := err.(*url.Error); ok {
+		return &url.Error{Op: e.Op, URL: logPath(e.URL), Err: e.Err}
+	}
+	return err
+}
+
+// 拼接接口地址，access_token为空时不附加
+func apiURL(path string, access_token string, params url.Values) string {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	if access_token != "" {
+		query.Set("access_token", access_token)
+	}
+	if len(query) == 0 {
+		return Host + path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return Host + path + sep + query.Encode()
+}
+
+// 解析接口响应并检查返回码
+func parseAPIResp(path string, content []byte, resp APIResp) (err error) {
+	path = logPath(path)
+	err = json.Unmarshal(content, resp)
+	if err != nil {
+		fmt.Println("wecom api "+path+" unmarshal err: ", err)
+		return err
+	}
+	if err = resp.GetErr(); err != nil {
+		fmt.Println("wecom api "+path+" err: ", err)
+		return err
+	}
+	fmt.Println("wecom api " + path + " success")
+	return nil
+}
+
 // VerifyURL
 // @Description: 验证回调URL
 func VerifyURL(c *gin.Context) {
@@ -176,6 +370,59 @@ func VerifyURL(c *gin.Context) {
 	ResponseString(c, http.StatusOK, string(echoStr))
 }
 
+// RegisterEventHandler
+// @Description: 注册事件回调处理函数，同一事件类型重复注册时覆盖
+func RegisterEventHandler(event string, handler CallbackHandler) {
+	eventHandlers[event] = handler
+}
+
+// 异步执行回调中的耗时处理，recover处理函数中的panic并记录日志，避免一个处理函数的panic导致整个服务退出
+func safeGo(name string, fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				fmt.Println(name+" panic: ", r, "\n", string(debug.Stack()))
+			}
+		}()
+		fn()
+	}()
+}
+
+// 按事件类型分发事件消息
+func dispatchEvent(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	var eventCommon CallbackEventCommon
+	err = xml.Unmarshal(msg, &eventCommon)
+	if err != nil {
+		fmt.Println("callback unmarshal event xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	handler, ok := eventHandlers[eventCommon.Event]
+	if !ok {
+		fmt.Println("callback unhandled event: ", eventCommon.Event, eventCommon.ChangeType)
+		return http.StatusOK, nil, nil
+	}
+	return handler(c, wxcpt, req, msg)
+}
+
+// EncryptResp
+// @Description: 将被动响应消息转成xml并加密
+func EncryptResp(wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, respMsgContent interface{}) (httpStatus int, encryptMsg []byte, err error) {
+	respMsgContentXML, err := xml.Marshal(respMsgContent)
+	if err != nil {
+		fmt.Println("callback marshal xml err: ", err)
+		return http.StatusInternalServerError, nil, err
+	}
+	fmt.Println("callback marshal xml : ", string(respMsgContentXML))
+
+	encryptMsg, cryptErr := wxcpt.EncryptMsg(string(respMsgContentXML), strconv.Itoa(req.Timestamp), req.Nonce)
+	if cryptErr != nil {
+		errStr := strconv.Itoa(cryptErr.ErrCode) + cryptErr.ErrMsg
+		fmt.Println("callback encrypt msg err: ", errStr)
+		return http.StatusInternalServerError, nil, errors.New(errStr)
+	}
+	return http.StatusOK, encryptMsg, nil
+}
+
 // Callback
 // @Description: 接收企业微信回调业务数据
 func Callback(c *gin.Context) {
@@ -236,8 +483,8 @@ func Callback(c *gin.Context) {
 	// 事件消息
 	case "event":
 		fmt.Println("callback event msg type")
-		// 测试回复更新模板卡片按钮交互文案
-		httpStatus, respMsg, err = CallbackTemplateCardButtonTest(c, wxcpt, req, msg)
+		// 按事件类型分发到注册的处理函数
+		httpStatus, respMsg, err = dispatchEvent(c, wxcpt, req, msg)
 	// 默认处理
 	default:
 		fmt.Println("callback default event msg type")
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// 业务key与群聊id的对应关系在存储中的key前缀
+const appChatKeyPrefix = "appchat:"
+
+// 同一业务key的获取或创建群聊需要串行，避免并发告警时重复建群
+var appChatLocks = NewKeyedMutex()
+
+// ***群聊会话 start***//
+// 群聊信息
+type AppChat struct {
+	ChatID   string   `json:"chatid,omitempty"` // 群聊的唯一标志
+	Name     string   `json:"name,omitempty"`   // 群聊名，最多50个utf8字符
+	Owner    string   `json:"owner,omitempty"`  // 群主id，不指定时随机选一人作为群主
+	UserList []string `json:"userlist"`         // 群成员id列表，至少2人，至多2000人
+	ChatType int      `json:"chat_type"`        // 群聊类型：0-普通群聊，1-应用创建的群聊
+}
+
+// 创建群聊响应字段
+type CreateAppChatResp struct {
+	CommonResp
+	ChatID string `json:"chatid"` // 群聊的唯一标志
+}
+
+// 修改群聊请求字段
+type UpdateAppChatReq struct {
+	ChatID      string   `json:"chatid"`                  // 群聊id
+	Name        string   `json:"name,omitempty"`          // 新的群聊名
+	Owner       string   `json:"owner,omitempty"`         // 新群主的id
+	AddUserList []string `json:"add_user_list,omitempty"` // 添加成员的id列表
+	DelUserList []string `json:"del_user_list,omitempty"` // 踢出成员的id列表
+}
+
+// 获取群聊响应字段
+type GetAppChatResp struct {
+	CommonResp
+	ChatInfo AppChat `json:"chat_info"` // 群聊信息
+}
+
+// 应用推送消息到群聊请求字段，按msgtype填写对应的消息内容
+type AppChatMsg struct {
+	ChatID  string `json:"chatid"`  // 群聊id
+	MsgType string `json:"msgtype"` // 消息类型
+	MsgContent
+	Safe int `json:"safe"` // 是否是保密消息，markdown不支持
+}
+
+// ***群聊会话 end***//
+
+// CreateAppChat
+// @Description: 创建群聊会话，返回群聊id
+func CreateAppChat(access_token string, chat *AppChat) (chatid string, err error) {
+	resp := new(CreateAppChatResp)
+	err = PostAPI("/cgi-bin/appchat/create", access_token, chat, resp)
+	return resp.ChatID, err
+}
+
+// UpdateAppChat
+// @Description: 修改群聊会话
+func UpdateAppChat(access_token string, req *UpdateAppChatReq) (err error) {
+	return PostAPI("/cgi-bin/appchat/update", access_token, req, new(CommonResp))
+}
+
+// GetAppChat
+// @Description: 获取群聊会话
+func GetAppChat(access_token string, chatid string) (chat *AppChat, err error) {
+	resp := new(GetAppChatResp)
+	err = GetAPI("/cgi-bin/appchat/get", access_token, url.Values{"chatid": {chatid}}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.ChatInfo, nil
+}
+
+// SendAppChatMsg
+// @Description: 应用推送消息到群聊，msgtype未设置时按填写的消息内容推断
+func SendAppChatMsg(access_token string, msg *AppChatMsg) (err error) {
+	if msg.MsgType == "" {
+		msg.MsgType = msg.MsgContent.InferMsgType()
+	}
+	return PostAPI("/cgi-bin/appchat/send", access_token, msg, new(CommonResp))
+}
+
+// SendAppChatText
+// @Description: 推送文本消息到群聊，超长内容按opt拆分或截断后依次发送
+func SendAppChatText(access_token string, chatid string, content string, opt ContentOption) (err error) {
+	parts, err := FitContent(content, TextContentMaxBytes, opt)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err = SendAppChatMsg(access_token, &AppChatMsg{ChatID: chatid, MsgType: "text", MsgContent: MsgContent{Text: &Text{Content: part}}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendAppChatMarkdown
+// @Description: 推送markdown消息到群聊，超长内容按opt拆分或截断后依次发送
+func SendAppChatMarkdown(access_token string, chatid string, content string, opt ContentOption) (err error) {
+	parts, err := FitMarkdown(content, opt)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err = SendAppChatMsg(access_token, &AppChatMsg{ChatID: chatid, MsgType: "markdown", MsgContent: MsgContent{Markdown: &Markdown{Content: part}}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnsureAppChat
+// @Description: 按业务key（如故障单号）获取群聊，已有群聊时补充缺少的成员，没有时创建新群聊，同一业务key的并发调用只会创建一个群聊
+func EnsureAppChat(access_token string, bizKey string, chat *AppChat) (chatid string, created bool, err error) {
+	unlock := appChatLocks.Lock(bizKey)
+	defer unlock()
+	if chatid, ok := Store.Get(appChatKeyPrefix + bizKey); ok {
+		existing, err := GetAppChat(access_token, chatid)
+		if err == nil {
+			if err = addMissingAppChatUsers(access_token, existing, chat.UserList); err != nil {
+				return chatid, false, err
+			}
+			return chatid, false, nil
+		}
+		// 仅在群聊确实不存在时重新创建，超时、限频等临时错误直接返回，避免同一业务key建出多个群
+		if !IsErrCode(err, ErrCodeAppChatNotFound) && !IsErrCode(err, ErrCodeInvalidChatID) {
+			return chatid, false, err
+		}
+		fmt.Println("ensure appchat "+chatid+" not found, recreate: ", err)
+	}
+
+	chatid, err = CreateAppChat(access_token, chat)
+	if err != nil {
+		return "", false, err
+	}
+	if err = Store.Set(appChatKeyPrefix+bizKey, chatid); err != nil {
+		fmt.Println("ensure appchat save err: ", err)
+	}
+	return chatid, true, nil
+}
+
+func addMissingAppChatUsers(access_token string, chat *AppChat, userids []string) (err error) {
+	members := map[string]bool{}
+	for _, userid := range chat.UserList {
+		members[strings.ToLower(userid)] = true
+	}
+	var missing []string
+	for _, userid := range userids {
+		if !members[strings.ToLower(userid)] {
+			missing = append(missing, userid)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return UpdateAppChat(access_token, &UpdateAppChatReq{ChatID: chat.ChatID, AddUserList: missing})
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+// 审批单在存储中的key前缀
+const approvalKeyPrefix = "approval:"
+
+// 审批策略
+const (
+	ApprovalPolicyAny    = "any"    // 或签：第一个审批人的决定即为结果
+	ApprovalPolicyAll    = "all"    // 会签：全部审批人通过才通过，任一驳回即驳回
+	ApprovalPolicyQuorum = "quorum" // 通过人数达到Quorum即通过
+)
+
+// 审批状态
+const (
+	ApprovalStatusPending  = "pending"  // 审批中
+	ApprovalStatusApproved = "approved" // 已通过
+	ApprovalStatusRejected = "rejected" // 已驳回
+	ApprovalStatusExpired  = "expired"  // 已过期
+)
+
+// 审批卡片按钮key值
+const (
+	ApprovalActionApprove = "approve" // 通过
+	ApprovalActionReject  = "reject"  // 驳回
+)
+
+// 审批单
+type Approval struct {
+	TaskID     string                      `json:"task_id"`                      // 任务id，发起时生成
+	BizKey     string                      `json:"biz_key"`                      // 业务系统的单据key，原样回传给webhook
+	Title      string                      `json:"title" binding:"required"`     // 卡片一级标题
+	Content    string                      `json:"content"`                      // 卡片二级普通文本
+	Fields     []HorizontalContent         `json:"fields"`                       // 卡片二级标题+文本列表
+	Requester  string                      `json:"requester"`                    // 发起人userid，审批结束后通知
+	Approvers  []string                    `json:"approvers" binding:"required"` // 审批人userid列表
+	Policy     string                      `json:"policy"`                       // 审批策略，默认any
+	Quorum     int                         `json:"quorum"`                       // quorum策略下需要的通过人数
+	ExpireAt   int64                       `json:"expire_at"`                    // 过期时间戳，0为不过期
+	WebhookURL string                      `json:"webhook_url"`                  // 审批结束后通知业务系统的地址，需在ApprovalWebhookOrigins中
+	Status     string                      `json:"status"`                       // 审批状态
+	Decisions  map[string]ApprovalDecision `json:"decisions"`                    // 审批人的决定，key为userid
+	CreateTime int64                       `json:"create_time"`                  // 发起时间戳
+	FinishTime int64                       `json:"finish_time"`                  // 结束时间戳
+}
+
+// 审批人的决定
+type ApprovalDecision struct {
+	UserID string `json:"userid"` // 审批人
+	Action string `json:"action"` // approve或reject
+	Time   int64  `json:"time"`   // 决定时间戳
+}
+
+// 审批结束后推送给业务系统的数据
+type ApprovalWebhook struct {
+	Event    string    `json:"event"`    // 固定为approval_finished
+	Approval *Approval `json:"approval"` // 审批单
+}
+
+// 审批单的读改写需要串行，避免并发回调丢失决定
+var approvalMu sync.Mutex
+
+func init() {
+	RegisterEventHandler("template_card_event", CallbackApprovalCard)
+}
+
+// StartApproval
+// @Description: 发起审批，生成任务id并向审批人发送按钮交互型卡片
+func StartApproval(access_token string, approval *Approval) (err error) {
+	if len(approval.Approvers) == 0 {
+		return errors.New("approval approvers is empty")
+	}
+	switch approval.Policy {
+	case "":
+		approval.Policy = ApprovalPolicyAny
+	case ApprovalPolicyAny, ApprovalPolicyAll:
+	case ApprovalPolicyQuorum:
+		if approval.Quorum <= 0 || approval.Quorum > len(approval.Approvers) {
+			return errors.New("approval quorum out of range: " + strconv.Itoa(approval.Quorum))
+		}
+	default:
+		return errors.New("unknown approval policy: " + approval.Policy)
+	}
+
+	if approval.WebhookURL != "" && !approvalWebhookAllowed(approval.WebhookURL) {
+		return errors.New("approval webhook_url not allowed: " + approval.WebhookURL)
+	}
+
+	approval.TaskID, err = newApprovalTaskID()
+	if err != nil {
+		return err
+	}
+	approval.Status = ApprovalStatusPending
+	approval.Decisions = map[string]ApprovalDecision{}
+	approval.CreateTime = time.Now().Unix()
+
+	sendMsg := SendMsgTemplateCardButton{
+		SendMsgCommon: SendMsgCommon{
+			ToUser:  strings.Join(approval.Approvers, "|"),
+			MsgType: "template_card",
+			AgentID: AgentID,
+		},
+		TemplateCard: TemplateCard{
+			CardType:              "button_interaction",
+			MainTitle:             MainTitle{Title: approval.Title},
+			SubTitleText:          approval.Content,
+			HorizontalContentList: approval.Fields,
+			TaskID:                approval.TaskID,
+			ButtonList: []Button{
+				{Text: "通过", Style: 1, Key: ApprovalActionApprove},
+				{Text: "驳回", Style: 2, Key: ApprovalActionReject},
+			},
+		},
+		DuplicateCheckInterval: 1800,
+	}
+	// 先保存审批单，避免审批人点击过快时回调找不到审批单
+	if err = saveApproval(approval); err != nil {
+		return err
+	}
+	_, err = SendTemplateCard(access_token, sendMsg)
+	if err != nil {
+		Store.Delete(approvalKeyPrefix + approval.TaskID)
+		return err
+	}
+	return nil
+}
+
+// GetApproval
+// @Description: 按任务id获取审批单
+func GetApproval(taskID string) (approval *Approval, ok bool, err error) {
+	approval = new(Approval)
+	ok, err = StoreGetJSON(approvalKeyPrefix+taskID, approval)
+	return approval, ok, err
+}
+
+func saveApproval(approval *Approval) error {
+	return StoreSetJSON(approvalKeyPrefix+approval.TaskID, approval)
+}
+
+// task_id仅支持数字、字母和"_-@"，最长128字节
+func newApprovalTaskID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "approval_" + strconv.FormatInt(time.Now().Unix(), 10) + "_" + hex.EncodeToString(b), nil
+}
+
+// DecideApproval
+// @Description: 记录审批人的决定并计算审批结果，返回更新后的审批单和本次决定是否生效
+func DecideApproval(taskID string, userid string, action string) (approval *Approval, accepted bool, err error) {
+	if action != ApprovalActionApprove && action != ApprovalActionReject {
+		return nil, false, errors.New("unknown approval action: " + action)
+	}
+	approvalMu.Lock()
+	defer approvalMu.Unlock()
+
+	approval, ok, err := GetApproval(taskID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, errors.New("approval not found: " + taskID)
+	}
+	if approval.Status != ApprovalStatusPending || !approval.isApprover(userid) {
+		return approval, false, nil
+	}
+	if _, decided := approval.Decisions[userid]; decided {
+		return approval, false, nil
+	}
+	approval.Decisions[userid] = ApprovalDecision{UserID: userid, Action: action, Time: time.Now().Unix()}
+	approval.Status = approval.evaluate()
+	if approval.Status != ApprovalStatusPending {
+		approval.FinishTime = time.Now().Unix()
+	}
+	return approval, true, saveApproval(approval)
+}
+
+func (a *Approval) isApprover(userid string) bool {
+	for _, approver := range a.Approvers {
+		// 回调中的userid可能与发送时大小写不一致
+		if strings.EqualFold(approver, userid) {
+			return true
+		}
+	}
+	return false
+}
+
+// 按审批策略计算当前状态
+func (a *Approval) evaluate() string {
+	approves, rejects := 0, 0
+	for _, decision := range a.Decisions {
+		if decision.Action == ApprovalActionApprove {
+			approves++
+		} else {
+			rejects++
+		}
+	}
+	total := len(a.Approvers)
+	switch a.Policy {
+	case ApprovalPolicyAll:
+		if rejects > 0 {
+			return ApprovalStatusRejected
+		}
+		if approves == total {
+			return ApprovalStatusApproved
+		}
+	case ApprovalPolicyQuorum:
+		if approves >= a.Quorum {
+			return ApprovalStatusApproved
+		}
+		if total-rejects < a.Quorum {
+			return ApprovalStatusRejected
+		}
+	default:
+		if approves > 0 {
+			return ApprovalStatusApproved
+		}
+		if rejects > 0 {
+			return ApprovalStatusRejected
+		}
+	}
+	return ApprovalStatusPending
+}
+
+// ExpireApprovals
+// @Description: 将已过期的审批中审批单置为过期并结束
+func ExpireApprovals(access_token string) {
+	now := time.Now().Unix()
+	for _, key := range Store.Keys(approvalKeyPrefix) {
+		approvalMu.Lock()
+		approval, ok, err := GetApproval(strings.TrimPrefix(key, approvalKeyPrefix))
+		if err != nil || !ok || approval.Status != ApprovalStatusPending || approval.ExpireAt == 0 || approval.ExpireAt > now {
+			approvalMu.Unlock()
+			continue
+		}
+		approval.Status = ApprovalStatusExpired
+		approval.FinishTime = now
+		err = saveApproval(approval)
+		approvalMu.Unlock()
+		if err != nil {
+			fmt.Println("expire approval err: ", err)
+			continue
+		}
+		FinishApproval(access_token, approval)
+	}
+}
+
+// RunApprovalExpiry
+// @Description: 定时检查过期审批单，阻塞运行
+func RunApprovalExpiry(interval time.Duration) {
+	for range time.Tick(interval) {
+		access_token, err := GetAppAccessToken()
+		if err != nil {
+			continue
+		}
+		ExpireApprovals(access_token)
+	}
+}
+
+// FinishApproval
+// @Description: 审批结束后更新所有审批人的卡片、通知发起人并推送webhook
+func FinishApproval(access_token string, approval *Approval) {
+	result := approvalStatusText(approval.Status)
+	if _, err := UpdateTaskCardButton(access_token, approval.TaskID, nil, result); err != nil {
+		fmt.Println("finish approval update card err: ", err)
+	}
+	if approval.Requester != "" {
+		content := "你发起的审批「" + approval.Title + "」" + result
+		_, err := SendText(access_token, SendMsgCommon{ToUser: approval.Requester, AgentID: AgentID}, content, ContentOption{Overflow: OverflowTruncate})
+		if err != nil {
+			fmt.Println("finish approval notify requester err: ", err)
+		}
+	}
+	if approval.WebhookURL != "" && approvalWebhookAllowed(approval.WebhookURL) {
+		body, _ := json.Marshal(ApprovalWebhook{Event: "approval_finished", Approval: approval})
+		if _, err := HttpPost(approval.WebhookURL, "application/json", bytes.NewReader(body)); err != nil {
+			fmt.Println("finish approval webhook err: ", err)
+		}
+	}
+}
+
+// webhook地址是否在允许列表中，避免被用来向内网任意地址发请求
+func approvalWebhookAllowed(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.User != nil {
+		return false
+	}
+	for _, origin := range ApprovalWebhookOrigins {
+		if u.Scheme+"://"+u.Host == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func approvalStatusText(status string) string {
+	switch status {
+	case ApprovalStatusApproved:
+		return "审批已通过"
+	case ApprovalStatusRejected:
+		return "审批已驳回"
+	case ApprovalStatusExpired:
+		return "审批已过期"
+	}
+	return "审批中"
+}
+
+// CallbackApprovalCard
+// @Description: 处理审批卡片按钮回调，非审批卡片交给测试处理函数
+func CallbackApprovalCard(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentTemplateCardButton)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback approval unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	if !strings.HasPrefix(reqMsgContent.TaskID, "approval_") {
+		return CallbackTemplateCardButtonTest(c, wxcpt, req, msg)
+	}
+	if err = SaveResponseCode(reqMsgContent.TaskID, reqMsgContent.ResponseCode); err != nil {
+		fmt.Println("callback approval save response_code err: ", err)
+	}
+
+	approval, accepted, err := DecideApproval(reqMsgContent.TaskID, reqMsgContent.FromUserName, reqMsgContent.EventKey)
+	if err != nil {
+		fmt.Println("callback approval decide err: ", err)
+		return http.StatusOK, nil, nil
+	}
+
+	// 审批结束时异步更新全部卡片，回调需要在5秒内响应
+	if accepted && approval.Status != ApprovalStatusPending {
+		safeGo("approval finish", func() {
+			access_token, err := GetAppAccessToken()
+			if err != nil {
+				return
+			}
+			FinishApproval(access_token, approval)
+		})
+	}
+
+	// 被动响应更新点击人的按钮文案
+	replaceName := approvalStatusText(approval.Status)
+	if accepted && approval.Status == ApprovalStatusPending {
+		replaceName = "已通过，等待其他人审批"
+		if reqMsgContent.EventKey == ApprovalActionReject {
+			replaceName = "已驳回，等待其他人审批"
+		}
+	}
+	respMsgContent := new(RespUpdateButton)
+	respMsgContent.ToUserName = reqMsgContent.FromUserName
+	respMsgContent.FromUserName = reqMsgContent.ToUserName
+	respMsgContent.CreateTime = int(time.Now().Unix())
+	respMsgContent.MsgType = "update_button"
+	respMsgContent.Button = UpdateButtonReplace{ReplaceName: replaceName}
+	return EncryptResp(wxcpt, req, respMsgContent)
+}
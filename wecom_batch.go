@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+// 异步任务结果回调在存储中的key前缀
+const batchJobKeyPrefix = "batch_job:"
+
+// 异步批量任务状态
+const (
+	BatchJobStatusStarted    = 1 // 任务开始
+	BatchJobStatusProcessing = 2 // 任务进行中
+	BatchJobStatusFinished   = 3 // 任务已完成
+)
+
+// 异步导出任务状态
+const (
+	ExportJobStatusPending    = 0 // 未处理
+	ExportJobStatusProcessing = 1 // 处理中
+	ExportJobStatusFinished   = 2 // 完成
+	ExportJobStatusFailed     = 3 // 异常失败
+)
+
+// ***异步批量接口 start***//
+// 异步任务完成后的回调设置，不填时推送到应用的回调URL
+type BatchCallback struct {
+	URL            string `json:"url,omitempty"`            // 企业应用接收企业微信推送请求的访问协议和地址
+	Token          string `json:"token,omitempty"`          // 用于生成签名
+	EncodingAESKey string `json:"encodingaeskey,omitempty"` // 用于消息体的加密
+}
+
+// 增量更新成员/全量覆盖成员/全量覆盖部门请求字段
+type BatchJobReq struct {
+	MediaID  string         `json:"media_id"`            // 上传的csv文件的media_id
+	ToInvite *bool          `json:"to_invite,omitempty"` // 是否邀请新建的成员使用企业微信，默认为true
+	Callback *BatchCallback `json:"callback,omitempty"`  // 回调信息
+}
+
+// 异步任务响应字段
+type BatchJobResp struct {
+	CommonResp
+	JobID string `json:"jobid"` // 异步任务id
+}
+
+// 获取异步任务结果响应字段
+type BatchJobResultResp struct {
+	CommonResp
+	Status     int              `json:"status"`     // 任务状态，1表示任务开始，2表示任务进行中，3表示任务已完成
+	Type       string           `json:"type"`       // 操作类型：sync_user、replace_user、replace_party
+	Total      int              `json:"total"`      // 任务运行总条数
+	Percentage int              `json:"percentage"` // 目前运行百分比
+	Result     []BatchJobResult `json:"result"`     // 详细的处理结果
+}
+
+// 每条数据的处理结果
+type BatchJobResult struct {
+	CommonResp
+	UserID  string `json:"userid,omitempty"`  // 成员UserID，成员任务返回
+	Action  int    `json:"action,omitempty"`  // 操作类型（按位或）：1新建部门，2更改部门名称，4移动部门，8修改部门排序，部门任务返回
+	PartyID int    `json:"partyid,omitempty"` // 部门id，部门任务返回
+}
+
+// 企业微信回调异步任务完成事件解密后的数据
+type ReqMsgContentBatchJobResult struct {
+	CallbackEventCommon
+	BatchJob BatchJobEvent `xml:"BatchJob"` // 异步任务信息
+}
+
+// 异步任务完成事件
+type BatchJobEvent struct {
+	JobID   string `xml:"JobId" json:"jobid"`     // 异步任务id
+	JobType string `xml:"JobType" json:"jobtype"` // 操作类型
+	ErrCode int    `xml:"ErrCode" json:"errcode"` // 返回码
+	ErrMsg  string `xml:"ErrMsg" json:"errmsg"`   // 对返回码的文本描述内容
+}
+
+// ***异步批量接口 end***//
+
+// ***异步导出接口 start***//
+// 导出请求字段
+type ExportReq struct {
+	EncodingAESKey string `json:"encoding_aeskey"`      // base64编码的加密密钥，长度固定为43
+	BlockSize      int    `json:"block_size,omitempty"` // 每块数据的人员数或部门数，默认为10^6
+	TagID          int    `json:"tagid,omitempty"`      // 需要导出的标签，仅导出标签成员时使用
+}
+
+// 导出任务
+type ExportJob struct {
+	JobID          string // 导出任务id
+	EncodingAESKey string // 导出文件的加密密钥
+}
+
+// 获取导出结果响应字段
+type ExportResultResp struct {
+	CommonResp
+	Status   int          `json:"status"`    // 任务状态:0-未处理，1-处理中，2-完成，3-异常失败
+	DataList []ExportData `json:"data_list"` // 数据列表
+}
+
+// 导出的数据文件
+type ExportData struct {
+	URL  string `json:"url"`  // 数据下载链接，支持指定Range头部分段下载，有效期2个小时
+	Size int64  `json:"size"` // 密文数据大小
+	MD5  string `json:"md5"`  // 密文数据md5
+}
+
+// 导出的成员/部门/标签成员数据
+type ExportContent struct {
+	UserList   []User       `json:"userlist"`   // 成员列表
+	Department []Department `json:"department"` // 部门列表
+	TagID      int          `json:"tagid"`      // 标签id，导出标签成员时返回
+	PartyList  []int        `json:"partylist"`  // 标签中的部门id，导出标签成员时返回
+}
+
+// ***异步导出接口 end***//
+
+func init() {
+	RegisterEventHandler("batch_job_result", CallbackBatchJobResult)
+}
+
+// SyncUser
+// @Description: 增量更新成员，mediaID为上传的csv文件
+func SyncUser(access_token string, req *BatchJobReq) (jobid string, err error) {
+	return submitBatchJob("/cgi-bin/batch/syncuser", access_token, req)
+}
+
+// ReplaceUser
+// @Description: 全量覆盖成员，mediaID为上传的csv文件
+func ReplaceUser(access_token string, req *BatchJobReq) (jobid string, err error) {
+	return submitBatchJob("/cgi-bin/batch/replaceuser", access_token, req)
+}
+
+// ReplaceParty
+// @Description: 全量覆盖部门，mediaID为上传的csv文件
+func ReplaceParty(access_token string, req *BatchJobReq) (jobid string, err error) {
+	return submitBatchJob("/cgi-bin/batch/replaceparty", access_token, &BatchJobReq{MediaID: req.MediaID, Callback: req.Callback})
+}
+
+func submitBatchJob(path string, access_token string, req *BatchJobReq) (jobid string, err error) {
+	resp := new(BatchJobResp)
+	err = PostAPI(path, access_token, req, resp)
+	return resp.JobID, err
+}
+
+// SubmitBatchCSV
+// @Description: 上传csv文件并提交异步批量任务，jobType为syncuser、replaceuser、replaceparty
+func SubmitBatchCSV(access_token string, jobType string, fileName string, csv []byte, callback *BatchCallback) (jobid string, err error) {
+	uploadResp, err := UploadMediaBytes(access_token, "file", fileName, csv)
+	if err != nil {
+		return "", err
+	}
+	req := &BatchJobReq{MediaID: uploadResp.MediaID, Callback: callback}
+	switch jobType {
+	case "syncuser":
+		return SyncUser(access_token, req)
+	case "replaceuser":
+		return ReplaceUser(access_token, req)
+	case "replaceparty":
+		return ReplaceParty(access_token, req)
+	}
+	return "", errors.New("unknown batch job type: " + jobType)
+}
+
+// GetBatchJobResult
+// @Description: 获取异步任务结果
+func GetBatchJobResult(access_token string, jobid string) (resp *BatchJobResultResp, err error) {
+	resp = new(BatchJobResultResp)
+	err = GetAPI("/cgi-bin/batch/getresult", access_token, url.Values{"jobid": {jobid}}, resp)
+	return resp, err
+}
+
+// WaitBatchJob
+// @Description: 轮询异步任务直到完成或超时，收到完成回调时立即查询结果
+func WaitBatchJob(access_token string, jobid string, interval time.Duration, timeout time.Duration) (resp *BatchJobResultResp, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if event, ok := GetBatchJobEvent(jobid); ok && event.ErrCode != 0 {
+			return nil, &WecomError{ErrCode: event.ErrCode, ErrMsg: event.ErrMsg}
+		}
+		resp, err = GetBatchJobResult(access_token, jobid)
+		if err != nil {
+			return resp, err
+		}
+		if resp.Status == BatchJobStatusFinished {
+			return resp, nil
+		}
+		if time.Now().After(deadline) {
+			return resp, errors.New("wait batch job timeout: " + jobid)
+		}
+		waitBatchJobEvent(jobid, interval)
+	}
+}
+
+// 等待interval，期间收到任务完成回调时提前返回，两次查询至少间隔1秒
+func waitBatchJobEvent(jobid string, interval time.Duration) {
+	until := time.Now().Add(interval)
+	for {
+		time.Sleep(time.Second)
+		if _, ok := GetBatchJobEvent(jobid); ok || !time.Now().Before(until) {
+			return
+		}
+	}
+}
+
+// GetBatchJobEvent
+// @Description: 获取回调推送的异步任务完成事件
+func GetBatchJobEvent(jobid string) (event *BatchJobEvent, ok bool) {
+	event = new(BatchJobEvent)
+	ok, err := StoreGetJSON(batchJobKeyPrefix+jobid, event)
+	return event, ok && err == nil
+}
+
+// CallbackBatchJobResult
+// @Description: 处理异步任务完成事件，保存结果供轮询使用
+func CallbackBatchJobResult(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentBatchJobResult)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback batch job result unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	fmt.Println("callback batch job result: ", reqMsgContent.BatchJob)
+	if err = StoreSetJSON(batchJobKeyPrefix+reqMsgContent.BatchJob.JobID, reqMsgContent.BatchJob); err != nil {
+		fmt.Println("callback batch job result save err: ", err)
+	}
+	// 全量覆盖类任务完成后通讯录变化较大，重新加载通讯录缓存
+	if strings.HasPrefix(reqMsgContent.BatchJob.JobType, "replace") || reqMsgContent.BatchJob.JobType == "sync_user" {
+		safeGo("batch job reload directory", func() {
+			access_token, err := GetAppAccessToken()
+			if err == nil {
+				err = Contacts.Load(access_token)
+			}
+			if err != nil {
+				fmt.Println("callback batch job reload directory err: ", err)
+			}
+		})
+	}
+	return http.StatusOK, nil, nil
+}
+
+// ExportSimpleUser
+// @Description: 导出成员（仅userid、name、department）
+func ExportSimpleUser(access_token string, blockSize int) (job *ExportJob, err error) {
+	return submitExport("/cgi-bin/export/simple_user", access_token, ExportReq{BlockSize: blockSize})
+}
+
+// ExportUser
+// @Description: 导出成员详情
+func ExportUser(access_token string, blockSize int) (job *ExportJob, err error) {
+	return submitExport("/cgi-bin/export/user", access_token, ExportReq{BlockSize: blockSize})
+}
+
+// ExportDepartment
+// @Description: 导出部门
+func ExportDepartment(access_token string, blockSize int) (job *ExportJob, err error) {
+	return submitExport("/cgi-bin/export/department", access_token, ExportReq{BlockSize: blockSize})
+}
+
+// ExportTagUser
+// @Description: 导出标签成员
+func ExportTagUser(access_token string, tagID int, blockSize int) (job *ExportJob, err error) {
+	return submitExport("/cgi-bin/export/taguser", access_token, ExportReq{TagID: tagID, BlockSize: blockSize})
+}
+
+// 提交导出任务，每个任务使用随机生成的加密密钥
+func submitExport(path string, access_token string, req ExportReq) (job *ExportJob, err error) {
+	key := make([]byte, 32)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	req.EncodingAESKey = strings.TrimRight(base64.StdEncoding.EncodeToString(key), "=")
+	resp := new(BatchJobResp)
+	err = PostAPI(path, access_token, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &ExportJob{JobID: resp.JobID, EncodingAESKey: req.EncodingAESKey}, nil
+}
+
+// GetExportResult
+// @Description: 获取导出结果
+func GetExportResult(access_token string, jobid string) (resp *ExportResultResp, err error) {
+	resp = new(ExportResultResp)
+	err = GetAPI("/cgi-bin/export/get_result", access_token, url.Values{"jobid": {jobid}}, resp)
+	return resp, err
+}
+
+// WaitExport
+// @Description: 轮询导出任务直到完成，下载并解密全部数据文件
+func WaitExport(access_token string, job *ExportJob, interval time.Duration, timeout time.Duration) (contents []ExportContent, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := GetExportResult(access_token, job.JobID)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.Status {
+		case ExportJobStatusFinished:
+			for _, data := range resp.DataList {
+				plain, err := DownloadExportData(data, job.EncodingAESKey)
+				if err != nil {
+					return contents, err
+				}
+				content := ExportContent{}
+				if err = json.Unmarshal(plain, &content); err != nil {
+					return contents, err
+				}
+				contents = append(contents, content)
+			}
+			return contents, nil
+		case ExportJobStatusFailed:
+			return nil, errors.New("export job failed: " + job.JobID)
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.New("wait export timeout: " + job.JobID)
+		}
+		waitBatchJobEvent(job.JobID, interval)
+	}
+}
+
+// DownloadExportData
+// @Description: 下载导出的数据文件，校验md5后解密
+func DownloadExportData(data ExportData, encodingAESKey string) (plain []byte, err error) {
+	content, err := HttpGet(data.URL)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum(content)
+	if data.MD5 != "" && !strings.EqualFold(hex.EncodeToString(sum[:]), data.MD5) {
+		return nil, errors.New("export data md5 mismatch, size: " + strconv.Itoa(len(content)))
+	}
+	return DecryptExportData(content, encodingAESKey)
+}
+
+// DecryptExportData
+// @Description: 解密导出的数据，AES-256-CBC，iv为密钥前16字节，PKCS#7填充
+func DecryptExportData(content []byte, encodingAESKey string) (plain []byte, err error) {
+	key, err := base64.StdEncoding.DecodeString(encodingAESKey + "=")
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 || len(content)%aes.BlockSize != 0 {
+		return nil, errors.New("export data size is not a multiple of the block size")
+	}
+	plain = make([]byte, len(content))
+	cipher.NewCBCDecrypter(block, key[:aes.BlockSize]).CryptBlocks(plain, content)
+
+	pad := int(plain[len(plain)-1])
+	if pad < 1 || pad > 32 || pad > len(plain) || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errors.New("export data padding invalid")
+	}
+	return plain[:len(plain)-pad], nil
+}
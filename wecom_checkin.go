@@ -0,0 +1,458 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// 打卡接口的分批限制
+const (
+	CheckinUserBatch = 100                 // 每次查询的用户数上限
+	CheckinMaxSpan   = 30 * 24 * time.Hour // 每次查询打卡记录的时间跨度上限
+	CheckinMaxDays   = 30                  // 每次查询打卡日报的天数上限
+)
+
+// 打卡类型
+const (
+	CheckinDataTypeWork    = 1 // 上下班打卡
+	CheckinDataTypeOutside = 2 // 外出打卡
+	CheckinDataTypeAll     = 3 // 全部打卡
+)
+
+// ***打卡 start***//
+// 获取员工打卡规则请求字段
+type CheckinOptionReq struct {
+	Datetime   int64    `json:"datetime"`   // 需要获取规则的日期当天0点的时间戳
+	UserIDList []string `json:"useridlist"` // 需要获取打卡规则的用户列表，最多100个
+}
+
+// 打卡时间
+type CheckinTime struct {
+	WorkSec          int `json:"work_sec"`            // 上班时间，距离0点的秒数
+	OffWorkSec       int `json:"off_work_sec"`        // 下班时间，距离0点的秒数
+	RemindWorkSec    int `json:"remind_work_sec"`     // 上班提醒时间，距离0点的秒数
+	RemindOffWorkSec int `json:"remind_off_work_sec"` // 下班提醒时间，距离0点的秒数
+}
+
+// 打卡日期及时间
+type CheckinDate struct {
+	Workdays       []int         `json:"workdays"`        // 工作日，0表示周日
+	CheckinTime    []CheckinTime `json:"checkintime"`     // 工作日上下班打卡时间
+	FlexTime       int           `json:"flex_time"`       // 弹性时间（毫秒）
+	NoneedOffwork  bool          `json:"noneed_offwork"`  // 下班不需要打卡
+	LimitAheadTime int           `json:"limit_aheadtime"` // 打卡时间限制（毫秒）
+}
+
+// 特殊日期
+type CheckinSpeDay struct {
+	Timestamp   int64         `json:"timestamp"`   // 特殊日期的时间戳
+	Notes       string        `json:"notes"`       // 特殊日期备注
+	CheckinTime []CheckinTime `json:"checkintime"` // 特殊日期的上下班打卡时间，仅必须打卡日期有
+}
+
+// 打卡地点
+type CheckinLocation struct {
+	Lat       int64  `json:"lat"`        // 纬度，实际值乘以1000000
+	Lng       int64  `json:"lng"`        // 经度，实际值乘以1000000
+	LocTitle  string `json:"loc_title"`  // 位置名称
+	LocDetail string `json:"loc_detail"` // 详细位置信息
+	Distance  int    `json:"distance"`   // 允许打卡范围（米）
+}
+
+// 打卡wifi
+type CheckinWifi struct {
+	WifiName string `json:"wifiname"` // wifi名称
+	WifiMac  string `json:"wifimac"`  // wifi的mac地址或bssid
+}
+
+// 打卡规则
+type CheckinGroup struct {
+	GroupType              int               `json:"grouptype"`                // 规则类型：1-固定时间上下班，2-按班次上下班，3-自由上下班
+	GroupID                int               `json:"groupid"`                  // 规则id
+	GroupName              string            `json:"groupname"`                // 规则名称
+	CheckinDate            []CheckinDate     `json:"checkindate"`              // 打卡日期及时间
+	SpeWorkdays            []CheckinSpeDay   `json:"spe_workdays"`             // 特殊日期-必须打卡日期
+	SpeOffdays             []CheckinSpeDay   `json:"spe_offdays"`              // 特殊日期-不用打卡日期
+	SyncHolidays           bool              `json:"sync_holidays"`            // 是否同步法定节假日
+	NeedPhoto              bool              `json:"need_photo"`               // 是否打卡必须拍照
+	NoteCanUseLocalPic     bool              `json:"note_can_use_local_pic"`   // 是否允许备注时使用本地图片
+	AllowCheckinOffworkday bool              `json:"allow_checkin_offworkday"` // 是否非工作日允许打卡
+	AllowApplyOffworkday   bool              `json:"allow_apply_offworkday"`   // 补卡申请
+	WifiMacInfos           []CheckinWifi     `json:"wifimac_infos"`            // 打卡地点-wifi打卡信息
+	LocInfos               []CheckinLocation `json:"loc_infos"`                // 打卡地点-位置打卡信息
+}
+
+// 员工打卡规则
+type CheckinUserOption struct {
+	UserID string       `json:"userid"` // 用户id
+	Group  CheckinGroup `json:"group"`  // 打卡规则
+}
+
+// 获取员工打卡规则响应字段
+type CheckinOptionResp struct {
+	CommonResp
+	Info []CheckinUserOption `json:"info"` // 员工打卡规则
+}
+
+// 获取企业所有打卡规则响应字段
+type CorpCheckinOptionResp struct {
+	CommonResp
+	Group []CheckinGroup `json:"group"` // 打卡规则列表
+}
+
+// 获取打卡记录请求字段
+type CheckinDataReq struct {
+	OpenCheckinDataType int      `json:"opencheckindatatype"` // 打卡类型：1-上下班打卡，2-外出打卡，3-全部打卡
+	StartTime           int64    `json:"starttime"`           // 开始时间戳
+	EndTime             int64    `json:"endtime"`             // 结束时间戳，与开始时间相差不能超过30天
+	UserIDList          []string `json:"useridlist"`          // 用户列表，最多100个
+}
+
+// 打卡记录
+type CheckinData struct {
+	UserID         string   `json:"userid"`           // 用户id
+	GroupName      string   `json:"groupname"`        // 打卡规则名称
+	CheckinType    string   `json:"checkin_type"`     // 打卡类型：上班打卡、下班打卡、外出打卡
+	ExceptionType  string   `json:"exception_type"`   // 异常类型，如时间异常、地点异常、未打卡，多个以分号分隔
+	CheckinTime    int64    `json:"checkin_time"`     // 打卡时间戳
+	LocationTitle  string   `json:"location_title"`   // 打卡地点title
+	LocationDetail string   `json:"location_detail"`  // 打卡地点详情
+	WifiName       string   `json:"wifiname"`         // 打卡wifi名称
+	Notes          string   `json:"notes"`            // 打卡备注
+	WifiMac        string   `json:"wifimac"`          // 打卡的mac地址/bssid
+	MediaIDs       []string `json:"mediaids"`         // 打卡的附件media_id
+	Lat            int64    `json:"lat"`              // 位置打卡地点纬度，实际值乘以1000000
+	Lng            int64    `json:"lng"`              // 位置打卡地点经度，实际值乘以1000000
+	DeviceID       string   `json:"deviceid"`         // 打卡设备id
+	SchCheckinTime int64    `json:"sch_checkin_time"` // 标准打卡时间
+	GroupID        int      `json:"groupid"`          // 规则id
+	ScheduleID     int      `json:"schedule_id"`      // 班次id
+	TimelineID     int      `json:"timeline_id"`      // 时段id
+}
+
+// 获取打卡记录响应字段
+type CheckinDataResp struct {
+	CommonResp
+	CheckinData []CheckinData `json:"checkindata"` // 打卡记录
+}
+
+// 获取打卡日报/月报请求字段
+type CheckinReportReq struct {
+	StartTime  int64    `json:"starttime"`  // 开始日期当天0点的时间戳
+	EndTime    int64    `json:"endtime"`    // 结束日期当天0点的时间戳
+	UserIDList []string `json:"useridlist"` // 用户列表，最多100个
+}
+
+// 打卡人员所属规则
+type CheckinRuleInfo struct {
+	GroupID      int           `json:"groupid"`      // 规则id
+	GroupName    string        `json:"groupname"`    // 规则名称
+	ScheduleID   int           `json:"scheduleid"`   // 班次id
+	ScheduleName string        `json:"schedulename"` // 班次名称
+	CheckinTime  []CheckinTime `json:"checkintime"`  // 当日打卡时间
+}
+
+// 打卡报表基础信息
+type CheckinBaseInfo struct {
+	Date        int64           `json:"date"`         // 日报日期，仅日报有
+	RecordType  int             `json:"record_type"`  // 记录类型：1-固定上下班，2-外出，3-按班次上下班，4-自由签到，5-加班，7-无规则
+	Name        string          `json:"name"`         // 打卡人员姓名
+	NameEx      string          `json:"name_ex"`      // 打卡人员别名
+	DepartsName string          `json:"departs_name"` // 打卡人员所在部门，多个以分号分隔
+	AcctID      string          `json:"acctid"`       // 打卡人员userid
+	RuleInfo    CheckinRuleInfo `json:"rule_info"`    // 打卡人员所属规则
+	DayType     int             `json:"day_type"`     // 日报日期类型：0-工作日，1-休息日，仅日报有
+}
+
+// 打卡异常统计
+type CheckinException struct {
+	Exception int `json:"exception"` // 异常类型：1-迟到，2-早退，3-缺卡，4-旷工，5-地点异常，6-设备异常
+	Count     int `json:"count"`     // 异常次数
+	Duration  int `json:"duration"`  // 异常时长（秒）
+}
+
+// 假勤统计
+type CheckinSpItem struct {
+	Type       int    `json:"type"`        // 类型：1-请假，2-补卡，3-出差，4-外出，100-外勤
+	VacationID int    `json:"vacation_id"` // 假期类型id，仅请假时有
+	Count      int    `json:"count"`       // 次数
+	Duration   int    `json:"duration"`    // 时长（秒）
+	TimeType   int    `json:"time_type"`   // 时长单位：0-按天，1-按小时
+	Name       string `json:"name"`        // 统计项名称
+}
+
+// 日报汇总信息
+type CheckinDaySummary struct {
+	CheckinCount    int   `json:"checkin_count"`     // 当日打卡次数
+	RegularWorkSec  int   `json:"regular_work_sec"`  // 当日实际工作时长（秒）
+	StandardWorkSec int   `json:"standard_work_sec"` // 当日标准工作时长（秒）
+	EarliestTime    int64 `json:"earliest_time"`     // 当日最早打卡时间
+	LastestTime     int64 `json:"lastest_time"`      // 当日最晚打卡时间
+}
+
+// 日报加班信息
+type CheckinOtInfo struct {
+	OtStatus          int   `json:"ot_status"`          // 状态：0-无加班，1-正常，2-缺时长
+	OtDuration        int   `json:"ot_duration"`        // 加班时长（秒）
+	ExceptionDuration []int `json:"exception_duration"` // 缺时长时的时长（秒）
+}
+
+// 打卡日报
+type CheckinDayData struct {
+	BaseInfo       CheckinBaseInfo    `json:"base_info"`       // 基础信息
+	SummaryInfo    CheckinDaySummary  `json:"summary_info"`    // 汇总信息
+	ExceptionInfos []CheckinException `json:"exception_infos"` // 异常状态统计
+	SpItems        []CheckinSpItem    `json:"sp_items"`        // 假勤统计
+	OtInfo         CheckinOtInfo      `json:"ot_info"`         // 加班信息
+}
+
+// 获取打卡日报响应字段
+type CheckinDayDataResp struct {
+	CommonResp
+	Datas []CheckinDayData `json:"datas"` // 日报数据
+}
+
+// 月报汇总信息
+type CheckinMonthSummary struct {
+	WorkDays        int `json:"work_days"`         // 应打卡天数
+	RegularDays     int `json:"regular_days"`      // 正常天数
+	ExceptDays      int `json:"except_days"`       // 异常天数
+	RegularWorkSec  int `json:"regular_work_sec"`  // 实际工作时长（秒）
+	StandardWorkSec int `json:"standard_work_sec"` // 标准工作时长（秒）
+}
+
+// 月报加班信息
+type CheckinOverworkInfo struct {
+	WorkdayOverSec  int `json:"workday_over_sec"`  // 工作日加班时长（秒）
+	HolidaysOverSec int `json:"holidays_over_sec"` // 节假日加班时长（秒）
+	RestdaysOverSec int `json:"restdays_over_sec"` // 休息日加班时长（秒）
+}
+
+// 打卡月报
+type CheckinMonthData struct {
+	BaseInfo       CheckinBaseInfo     `json:"base_info"`       // 基础信息
+	SummaryInfo    CheckinMonthSummary `json:"summary_info"`    // 汇总信息
+	ExceptionInfos []CheckinException  `json:"exception_infos"` // 异常状态统计
+	SpItems        []CheckinSpItem     `json:"sp_items"`        // 假勤统计
+	OverworkInfo   CheckinOverworkInfo `json:"overwork_info"`   // 加班信息
+}
+
+// 获取打卡月报响应字段
+type CheckinMonthDataResp struct {
+	CommonResp
+	Datas []CheckinMonthData `json:"datas"` // 月报数据
+}
+
+// ***打卡 end***//
+
+// 按用户和时间分批后的一次查询
+type checkinChunk struct {
+	userids   []string
+	startTime int64
+	endTime   int64
+}
+
+// 按时间窗口拆分查询范围，返回每个窗口的开始和结束时间
+type checkinWindows func(start, end time.Time) [][2]time.Time
+
+// 将用户列表按100个、时间范围按windows拆分为多次查询
+func checkinChunks(userids []string, start, end time.Time, windows checkinWindows) (chunks []checkinChunk) {
+	ranges := windows(start, end)
+	for i := 0; i < len(userids); i += CheckinUserBatch {
+		j := i + CheckinUserBatch
+		if j > len(userids) {
+			j = len(userids)
+		}
+		for _, r := range ranges {
+			chunks = append(chunks, checkinChunk{userids[i:j], r[0].Unix(), r[1].Unix()})
+		}
+	}
+	return chunks
+}
+
+// 当天0点，按t所在时区计算
+func checkinDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// 打卡记录按30天拆分，每个窗口结束于下一窗口开始前1秒
+func checkinRecordWindows(start, end time.Time) (ranges [][2]time.Time) {
+	for s := start; !s.After(end); s = s.Add(CheckinMaxSpan) {
+		e := s.Add(CheckinMaxSpan - time.Second)
+		if e.After(end) {
+			e = end
+		}
+		ranges = append(ranges, [2]time.Time{s, e})
+	}
+	return ranges
+}
+
+// 打卡日报按30天拆分，开始和结束都是当天0点，窗口包含首尾两天
+func checkinDayWindows(start, end time.Time) (ranges [][2]time.Time) {
+	end = checkinDay(end)
+	for s := checkinDay(start); !s.After(end); s = s.AddDate(0, 0, CheckinMaxDays) {
+		e := s.AddDate(0, 0, CheckinMaxDays-1)
+		if e.After(end) {
+			e = end
+		}
+		ranges = append(ranges, [2]time.Time{s, e})
+	}
+	return ranges
+}
+
+// 打卡月报按自然月拆分，开始和结束都是当天0点，每个窗口汇总为一条月报
+func checkinMonthWindows(start, end time.Time) (ranges [][2]time.Time) {
+	end = checkinDay(end)
+	for s := checkinDay(start); !s.After(end); {
+		// 下个月的第0天即本月最后一天
+		e := time.Date(s.Year(), s.Month()+1, 0, 0, 0, 0, 0, s.Location())
+		if e.After(end) {
+			e = end
+		}
+		ranges = append(ranges, [2]time.Time{s, e})
+		s = e.AddDate(0, 0, 1)
+	}
+	return ranges
+}
+
+// 打卡规则只查询一天，取当天0点
+func checkinOptionWindows(start, end time.Time) [][2]time.Time {
+	day := checkinDay(start)
+	return [][2]time.Time{{day, day}}
+}
+
+// 逐批查询，以批次下标作为游标复用cursorPager，fetch返回本批条数
+func newCheckinPager(chunks []checkinChunk, fetch func(chunk checkinChunk) (int, error)) cursorPager {
+	return newCursorPager(func(cursor string) (int, string, error) {
+		i, _ := strconv.Atoi(cursor)
+		if i >= len(chunks) {
+			return 0, "", nil
+		}
+		size, err := fetch(chunks[i])
+		if err != nil {
+			return 0, "", err
+		}
+		next := ""
+		if i+1 < len(chunks) {
+			next = strconv.Itoa(i + 1)
+		}
+		return size, next, nil
+	})
+}
+
+// GetCheckinOption
+// @Description: 获取员工在指定日期的打卡规则，date按所在时区取当天0点，超过100个用户时分批获取
+func GetCheckinOption(access_token string, date time.Time, userids []string) (options []CheckinUserOption, err error) {
+	for _, chunk := range checkinChunks(userids, date, date, checkinOptionWindows) {
+		resp := new(CheckinOptionResp)
+		err = PostAPI("/cgi-bin/checkin/getcheckinoption", access_token, CheckinOptionReq{Datetime: chunk.startTime, UserIDList: chunk.userids}, resp)
+		if err != nil {
+			return options, err
+		}
+		options = append(options, resp.Info...)
+	}
+	return options, nil
+}
+
+// GetCorpCheckinOption
+// @Description: 获取企业所有打卡规则
+func GetCorpCheckinOption(access_token string) (groups []CheckinGroup, err error) {
+	resp := new(CorpCheckinOptionResp)
+	err = PostAPI("/cgi-bin/checkin/getcorpcheckinoption", access_token, struct{}{}, resp)
+	return resp.Group, err
+}
+
+// GetCheckinData
+// @Description: 获取一批打卡记录，用户不超过100个且时间跨度不超过30天
+func GetCheckinData(access_token string, req *CheckinDataReq) (data []CheckinData, err error) {
+	resp := new(CheckinDataResp)
+	err = PostAPI("/cgi-bin/checkin/getcheckindata", access_token, req, resp)
+	return resp.CheckinData, err
+}
+
+// 打卡记录迭代器
+type CheckinDataIterator struct {
+	cursorPager
+	page []CheckinData
+}
+
+// IterCheckinData
+// @Description: 逐条遍历打卡记录，自动按100个用户、30天拆分查询
+func IterCheckinData(access_token string, dataType int, userids []string, start, end time.Time) *CheckinDataIterator {
+	it := new(CheckinDataIterator)
+	it.cursorPager = newCheckinPager(checkinChunks(userids, start, end, checkinRecordWindows), func(chunk checkinChunk) (int, error) {
+		data, err := GetCheckinData(access_token, &CheckinDataReq{
+			OpenCheckinDataType: dataType,
+			StartTime:           chunk.startTime,
+			EndTime:             chunk.endTime,
+			UserIDList:          chunk.userids,
+		})
+		it.page = data
+		return len(data), err
+	})
+	return it
+}
+
+func (it *CheckinDataIterator) Next() bool         { return it.next() }
+func (it *CheckinDataIterator) Value() CheckinData { return it.page[it.index] }
+func (it *CheckinDataIterator) Err() error         { return it.err }
+
+// GetCheckinDayData
+// @Description: 获取一批打卡日报，用户不超过100个且时间跨度不超过30天
+func GetCheckinDayData(access_token string, req *CheckinReportReq) (data []CheckinDayData, err error) {
+	resp := new(CheckinDayDataResp)
+	err = PostAPI("/cgi-bin/checkin/getcheckin_daydata", access_token, req, resp)
+	return resp.Datas, err
+}
+
+// 打卡日报迭代器
+type CheckinDayDataIterator struct {
+	cursorPager
+	page []CheckinDayData
+}
+
+// IterCheckinDayData
+// @Description: 逐条遍历打卡日报，start和end按所在时区取当天0点，自动按100个用户、30天拆分查询
+func IterCheckinDayData(access_token string, userids []string, start, end time.Time) *CheckinDayDataIterator {
+	it := new(CheckinDayDataIterator)
+	it.cursorPager = newCheckinPager(checkinChunks(userids, start, end, checkinDayWindows), func(chunk checkinChunk) (int, error) {
+		data, err := GetCheckinDayData(access_token, &CheckinReportReq{StartTime: chunk.startTime, EndTime: chunk.endTime, UserIDList: chunk.userids})
+		it.page = data
+		return len(data), err
+	})
+	return it
+}
+
+func (it *CheckinDayDataIterator) Next() bool            { return it.next() }
+func (it *CheckinDayDataIterator) Value() CheckinDayData { return it.page[it.index] }
+func (it *CheckinDayDataIterator) Err() error            { return it.err }
+
+// GetCheckinMonthData
+// @Description: 获取一批打卡月报，用户不超过100个且时间跨度不超过一个月
+func GetCheckinMonthData(access_token string, req *CheckinReportReq) (data []CheckinMonthData, err error) {
+	resp := new(CheckinMonthDataResp)
+	err = PostAPI("/cgi-bin/checkin/getcheckin_monthdata", access_token, req, resp)
+	return resp.Datas, err
+}
+
+// 打卡月报迭代器
+type CheckinMonthDataIterator struct {
+	cursorPager
+	page []CheckinMonthData
+}
+
+// IterCheckinMonthData
+// @Description: 逐条遍历打卡月报，自动按100个用户和自然月拆分查询，每个用户每个自然月返回一条月报，首尾月份按实际范围汇总
+func IterCheckinMonthData(access_token string, userids []string, start, end time.Time) *CheckinMonthDataIterator {
+	it := new(CheckinMonthDataIterator)
+	it.cursorPager = newCheckinPager(checkinChunks(userids, start, end, checkinMonthWindows), func(chunk checkinChunk) (int, error) {
+		data, err := GetCheckinMonthData(access_token, &CheckinReportReq{StartTime: chunk.startTime, EndTime: chunk.endTime, UserIDList: chunk.userids})
+		it.page = data
+		return len(data), err
+	})
+	return it
+}
+
+func (it *CheckinMonthDataIterator) Next() bool              { return it.next() }
+func (it *CheckinMonthDataIterator) Value() CheckinMonthData { return it.page[it.index] }
+func (it *CheckinMonthDataIterator) Err() error              { return it.err }
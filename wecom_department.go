@@ -0,0 +1,199 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ***通讯录部门 start***//
+// 部门信息
+type Department struct {
+	ID               int      `json:"id,omitempty"`                // 部门id
+	Name             string   `json:"name,omitempty"`              // 部门名称
+	NameEn           string   `json:"name_en,omitempty"`           // 英文名称
+	DepartmentLeader []string `json:"department_leader,omitempty"` // 部门负责人的UserID
+	ParentID         int      `json:"parentid,omitempty"`          // 父部门id，根部门为1
+	Order            int      `json:"order,omitempty"`             // 在父部门中的次序值
+}
+
+// 创建部门响应字段
+type CreateDepartmentResp struct {
+	CommonResp
+	ID int `json:"id"` // 创建的部门id
+}
+
+// 部门列表响应字段
+type DepartmentListResp struct {
+	CommonResp
+	Department []Department `json:"department"` // 部门列表
+}
+
+// 子部门id列表响应字段
+type DepartmentSimpleListResp struct {
+	CommonResp
+	DepartmentID []Department `json:"department_id"` // 部门列表，仅包含id、parentid、order
+}
+
+// 单个部门详情响应字段
+type GetDepartmentResp struct {
+	CommonResp
+	Department Department `json:"department"` // 部门详情
+}
+
+// ***通讯录部门 end***//
+
+// CreateDepartment
+// @Description: 创建部门，返回部门id
+func CreateDepartment(access_token string, department *Department) (id int, err error) {
+	resp := new(CreateDepartmentResp)
+	err = PostAPI("/cgi-bin/department/create", access_token, department, resp)
+	return resp.ID, err
+}
+
+// UpdateDepartment
+// @Description: 更新部门，仅更新设置了值的字段
+func UpdateDepartment(access_token string, department *Department) (err error) {
+	return PostAPI("/cgi-bin/department/update", access_token, department, new(CommonResp))
+}
+
+// DeleteDepartment
+// @Description: 删除部门，不能删除根部门及含有子部门、成员的部门
+func DeleteDepartment(access_token string, id int) (err error) {
+	return GetAPI("/cgi-bin/department/delete", access_token, url.Values{"id": {strconv.Itoa(id)}}, new(CommonResp))
+}
+
+// ListDepartment
+// @Description: 获取部门及其下的子部门详情，id为0时获取全量组织架构
+func ListDepartment(access_token string, id int) (departments []Department, err error) {
+	resp := new(DepartmentListResp)
+	err = GetAPI("/cgi-bin/department/list", access_token, departmentIDParams(id), resp)
+	return resp.Department, err
+}
+
+// ListSimpleDepartment
+// @Description: 获取部门及其下的子部门id，id为0时获取全量组织架构
+func ListSimpleDepartment(access_token string, id int) (departments []Department, err error) {
+	resp := new(DepartmentSimpleListResp)
+	err = GetAPI("/cgi-bin/department/simplelist", access_token, departmentIDParams(id), resp)
+	return resp.DepartmentID, err
+}
+
+// GetDepartment
+// @Description: 获取单个部门详情
+func GetDepartment(access_token string, id int) (department *Department, err error) {
+	resp := new(GetDepartmentResp)
+	err = GetAPI("/cgi-bin/department/get", access_token, departmentIDParams(id), resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.Department, nil
+}
+
+func departmentIDParams(id int) url.Values {
+	if id == 0 {
+		return nil
+	}
+	return url.Values{"id": {strconv.Itoa(id)}}
+}
+
+// VisibleRootDepartments
+// @Description: 返回部门列表中父部门不在列表内的部门，即应用可见范围内的顶层部门，可见范围不含根部门时不止一个
+func VisibleRootDepartments(departments []Department) (roots []Department) {
+	ids := map[int]bool{}
+	for _, department := range departments {
+		ids[department.ID] = true
+	}
+	for _, department := range departments {
+		if !ids[department.ParentID] {
+			roots = append(roots, department)
+		}
+	}
+	return roots
+}
+
+// FindDepartmentByPath
+// @Description: 在部门列表中按"Engineering/Backend"形式的路径查找部门id，路径可以包含可见的顶层部门名称，
+// 不包含时从所有顶层部门的子部门开始查找
+func FindDepartmentByPath(departments []Department, path string) (id int, err error) {
+	children := map[int][]Department{}
+	for _, department := range departments {
+		children[department.ParentID] = append(children[department.ParentID], department)
+	}
+
+	var names []string
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return 0, errors.New("empty department path")
+	}
+
+	var parents []int
+	for _, root := range VisibleRootDepartments(departments) {
+		if root.Name == names[0] || root.NameEn == names[0] {
+			id, parents, names = root.ID, []int{root.ID}, names[1:]
+			break
+		}
+		parents = append(parents, root.ID)
+	}
+
+	for _, name := range names {
+		found := false
+		for _, parentID := range parents {
+			for _, child := range children[parentID] {
+				if child.Name == name || child.NameEn == name {
+					id, found = child.ID, true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return 0, errors.New("department not found: " + path)
+		}
+		parents = []int{id}
+	}
+	return id, nil
+}
+
+// ResolveSendTarget
+// @Description: 将部门路径和标签名称解析为发送消息使用的toparty、totag
+func ResolveSendTarget(access_token string, departmentPaths []string, tagNames []string) (toParty string, toTag string, err error) {
+	if len(departmentPaths) > 0 {
+		departments, err := ListDepartment(access_token, 0)
+		if err != nil {
+			return "", "", err
+		}
+		var ids []string
+		for _, path := range departmentPaths {
+			id, err := FindDepartmentByPath(departments, path)
+			if err != nil {
+				return "", "", err
+			}
+			ids = append(ids, strconv.Itoa(id))
+		}
+		toParty = strings.Join(ids, "|")
+	}
+	if len(tagNames) > 0 {
+		tags, err := ListTag(access_token)
+		if err != nil {
+			return "", "", err
+		}
+		var ids []string
+		for _, name := range tagNames {
+			id, err := FindTagByName(tags, name)
+			if err != nil {
+				return "", "", err
+			}
+			ids = append(ids, strconv.Itoa(id))
+		}
+		toTag = strings.Join(ids, "|")
+	}
+	return toParty, toTag, nil
+}
@@ -0,0 +1,491 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+// 企业微信回调通讯录变更事件解密后的数据，不同ChangeType只带部分字段
+type ReqMsgContentChangeContact struct {
+	CallbackEventCommon
+	// 成员变更
+	UserID         string `xml:"UserID"`         // 成员UserID
+	NewUserID      string `xml:"NewUserID"`      // 新的UserID，变更时推送
+	Name           string `xml:"Name"`           // 成员/部门名称
+	Department     string `xml:"Department"`     // 成员部门列表，逗号分隔
+	MainDepartment int    `xml:"MainDepartment"` // 主部门
+	IsLeaderInDept string `xml:"IsLeaderInDept"` // 是否为部门负责人，逗号分隔，与Department对应
+	DirectLeader   string `xml:"DirectLeader"`   // 直属上级，逗号分隔
+	Position       string `xml:"Position"`       // 职位信息
+	Mobile         string `xml:"Mobile"`         // 手机号码
+	Gender         string `xml:"Gender"`         // 性别
+	Email          string `xml:"Email"`          // 邮箱
+	BizMail        string `xml:"BizMail"`        // 企业邮箱
+	Status         int    `xml:"Status"`         // 激活状态
+	Avatar         string `xml:"Avatar"`         // 头像url
+	Alias          string `xml:"Alias"`          // 成员别名
+	Telephone      string `xml:"Telephone"`      // 座机
+	Address        string `xml:"Address"`        // 地址
+	// 部门变更
+	ID       int `xml:"Id"`       // 部门id
+	ParentID int `xml:"ParentId"` // 父部门id
+	Order    int `xml:"Order"`    // 部门排序
+	// 标签变更
+	TagID         int    `xml:"TagId"`         // 标签id
+	AddUserItems  string `xml:"AddUserItems"`  // 标签中新增的成员userid列表，逗号分隔
+	DelUserItems  string `xml:"DelUserItems"`  // 标签中删除的成员userid列表，逗号分隔
+	AddPartyItems string `xml:"AddPartyItems"` // 标签中新增的部门id列表，逗号分隔
+	DelPartyItems string `xml:"DelPartyItems"` // 标签中删除的部门id列表，逗号分隔
+}
+
+// 本地通讯录缓存，启动时全量加载，之后通过通讯录变更回调增量更新并定期全量校准
+type Directory struct {
+	mu          sync.RWMutex
+	users       map[string]*User              // userid到成员
+	departments map[int]*Department           // 部门id到部门
+	tags        map[int]*Tag                  // 标签id到标签
+	tagUsers    map[int]map[string]bool       // 标签id到成员userid
+	tagParties  map[int]map[int]bool          // 标签id到部门id
+	loadTime    time.Time                     // 最近一次全量加载时间
+	loading     bool                          // 是否正在全量加载
+	pending     []*ReqMsgContentChangeContact // 全量加载期间收到的变更事件，替换缓存后重放
+}
+
+// 全局通讯录缓存
+var Contacts = NewDirectory()
+
+func init() {
+	RegisterEventHandler("change_contact", CallbackChangeContact)
+}
+
+func NewDirectory() *Directory {
+	return &Directory{
+		users:       map[string]*User{},
+		departments: map[int]*Department{},
+		tags:        map[int]*Tag{},
+		tagUsers:    map[int]map[string]bool{},
+		tagParties:  map[int]map[int]bool{},
+	}
+}
+
+// Load
+// @Description: 从通讯录接口全量加载部门、成员和标签，加载完成后整体替换缓存
+func (d *Directory) Load(access_token string) (err error) {
+	fmt.Println("directory load...")
+	d.mu.Lock()
+	d.loading, d.pending = true, nil
+	d.mu.Unlock()
+	defer func() {
+		if err != nil {
+			d.mu.Lock()
+			d.loading, d.pending = false, nil
+			d.mu.Unlock()
+		}
+	}()
+
+	departments, err := ListDepartment(access_token, 0)
+	if err != nil {
+		return err
+	}
+	// 应用可见范围不一定包含根部门，从每个可见的顶层部门递归获取成员
+	var users []User
+	for _, root := range VisibleRootDepartments(departments) {
+		rootUsers, err := ListUser(access_token, root.ID, true)
+		if err != nil {
+			return err
+		}
+		users = append(users, rootUsers...)
+	}
+	tags, err := ListTag(access_token)
+	if err != nil {
+		return err
+	}
+
+	loaded := NewDirectory()
+	for i := range departments {
+		loaded.departments[departments[i].ID] = &departments[i]
+	}
+	for i := range users {
+		loaded.users[users[i].UserID] = &users[i]
+	}
+	for i := range tags {
+		tag := &tags[i]
+		loaded.tags[tag.TagID] = tag
+		members, err := GetTag(access_token, tag.TagID)
+		if err != nil {
+			return err
+		}
+		loaded.tagUsers[tag.TagID] = map[string]bool{}
+		for _, user := range members.UserList {
+			loaded.tagUsers[tag.TagID][user.UserID] = true
+		}
+		loaded.tagParties[tag.TagID] = map[int]bool{}
+		for _, partyID := range members.PartyList {
+			loaded.tagParties[tag.TagID][partyID] = true
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.users, d.departments, d.tags = loaded.users, loaded.departments, loaded.tags
+	d.tagUsers, d.tagParties = loaded.tagUsers, loaded.tagParties
+	// 加载期间的变更可能没有包含在全量数据中，替换后重放一遍
+	for _, event := range d.pending {
+		d.apply(event)
+	}
+	fmt.Println("directory load success, users: ", len(d.users), " departments: ", len(d.departments), " tags: ", len(d.tags), " replayed: ", len(d.pending))
+	d.loading, d.pending = false, nil
+	d.loadTime = time.Now()
+	return nil
+}
+
+// Run
+// @Description: 启动时全量加载，之后每隔interval全量校准一次，阻塞运行
+func (d *Directory) Run(interval time.Duration) {
+	for {
+		access_token, err := GetAppAccessToken()
+		if err == nil {
+			err = d.Load(access_token)
+		}
+		if err != nil {
+			fmt.Println("directory load err: ", err)
+			// 加载失败时稍后重试
+			time.Sleep(time.Minute)
+			continue
+		}
+		time.Sleep(interval)
+	}
+}
+
+// Apply
+// @Description: 应用一条通讯录变更事件，标签变更涉及未缓存的标签时异步获取标签名称
+func (d *Directory) Apply(event *ReqMsgContentChangeContact) {
+	d.mu.Lock()
+	if d.loading {
+		d.pending = append(d.pending, event)
+	}
+	d.apply(event)
+	_, known := d.tags[event.TagID]
+	d.mu.Unlock()
+	if event.ChangeType == "update_tag" && !known {
+		safeGo("directory fetch tag", func() {
+			d.fetchTag(event.TagID)
+		})
+	}
+}
+
+// 获取标签名称并加入缓存，获取失败时等待下次全量校准
+func (d *Directory) fetchTag(tagID int) {
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		return
+	}
+	resp, err := GetTag(access_token, tagID)
+	if err != nil {
+		fmt.Println("directory fetch tag err: ", tagID, err)
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.tags[tagID]; !ok {
+		d.tags[tagID] = &Tag{TagID: tagID, TagName: resp.TagName}
+	}
+}
+
+// 应用变更事件，调用方需持有写锁
+func (d *Directory) apply(event *ReqMsgContentChangeContact) {
+	switch event.ChangeType {
+	case "create_user", "update_user":
+		user, ok := d.users[event.UserID]
+		if !ok {
+			user = &User{UserID: event.UserID}
+		}
+		mergeChangedUser(user, event)
+		if event.NewUserID != "" && event.NewUserID != event.UserID {
+			delete(d.users, event.UserID)
+			user.UserID = event.NewUserID
+			for _, members := range d.tagUsers {
+				if members[event.UserID] {
+					delete(members, event.UserID)
+					members[event.NewUserID] = true
+				}
+			}
+		}
+		d.users[user.UserID] = user
+	case "delete_user":
+		delete(d.users, event.UserID)
+		for _, members := range d.tagUsers {
+			delete(members, event.UserID)
+		}
+	case "create_party", "update_party":
+		department, ok := d.departments[event.ID]
+		if !ok {
+			department = &Department{ID: event.ID}
+			d.departments[event.ID] = department
+		}
+		if event.Name != "" {
+			department.Name = event.Name
+		}
+		if event.ParentID != 0 {
+			department.ParentID = event.ParentID
+		}
+		if event.Order != 0 {
+			department.Order = event.Order
+		}
+	case "delete_party":
+		delete(d.departments, event.ID)
+		for _, parties := range d.tagParties {
+			delete(parties, event.ID)
+		}
+	case "update_tag":
+		// 未知标签先只记录成员变化，标签名称由Apply异步获取后再加入缓存，避免缓存没有名称的标签
+		if _, ok := d.tagUsers[event.TagID]; !ok {
+			d.tagUsers[event.TagID] = map[string]bool{}
+			d.tagParties[event.TagID] = map[int]bool{}
+		}
+		for _, userid := range splitItems(event.AddUserItems) {
+			d.tagUsers[event.TagID][userid] = true
+		}
+		for _, userid := range splitItems(event.DelUserItems) {
+			delete(d.tagUsers[event.TagID], userid)
+		}
+		for _, partyID := range splitIntItems(event.AddPartyItems) {
+			d.tagParties[event.TagID][partyID] = true
+		}
+		for _, partyID := range splitIntItems(event.DelPartyItems) {
+			delete(d.tagParties[event.TagID], partyID)
+		}
+	default:
+		fmt.Println("directory unknown change type: ", event.ChangeType)
+	}
+}
+
+// 变更事件只推送有变化的字段，未推送的字段保留原值
+func mergeChangedUser(user *User, event *ReqMsgContentChangeContact) {
+	if event.Name != "" {
+		user.Name = event.Name
+	}
+	if event.Department != "" {
+		user.Department = splitIntItems(event.Department)
+	}
+	if event.MainDepartment != 0 {
+		user.MainDepartment = event.MainDepartment
+	}
+	if event.IsLeaderInDept != "" {
+		user.IsLeaderInDept = splitIntItems(event.IsLeaderInDept)
+	}
+	if event.DirectLeader != "" {
+		user.DirectLeader = splitItems(event.DirectLeader)
+	}
+	if event.Position != "" {
+		user.Position = event.Position
+	}
+	if event.Mobile != "" {
+		user.Mobile = event.Mobile
+	}
+	if event.Gender != "" {
+		user.Gender = event.Gender
+	}
+	if event.Email != "" {
+		user.Email = event.Email
+	}
+	if event.BizMail != "" {
+		user.BizMail = event.BizMail
+	}
+	if event.Status != 0 {
+		user.Status = event.Status
+	}
+	if event.Avatar != "" {
+		user.Avatar = event.Avatar
+	}
+	if event.Alias != "" {
+		user.Alias = event.Alias
+	}
+	if event.Telephone != "" {
+		user.Telephone = event.Telephone
+	}
+	if event.Address != "" {
+		user.Address = event.Address
+	}
+}
+
+func splitItems(items string) (values []string) {
+	for _, item := range strings.Split(items, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
+
+func splitIntItems(items string) (values []int) {
+	for _, item := range splitItems(items) {
+		if value, err := strconv.Atoi(item); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// LoadTime
+// @Description: 最近一次全量加载时间，零值表示尚未加载
+func (d *Directory) LoadTime() time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.loadTime
+}
+
+// User
+// @Description: 按userid查找成员，userid不区分大小写
+func (d *Directory) User(userid string) (user User, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if u, ok := d.users[userid]; ok {
+		return *u, true
+	}
+	for id, u := range d.users {
+		if strings.EqualFold(id, userid) {
+			return *u, true
+		}
+	}
+	return User{}, false
+}
+
+// UsersByName
+// @Description: 按姓名查找成员，可能重名
+func (d *Directory) UsersByName(name string) (users []User) {
+	return d.filterUsers(func(user *User) bool {
+		return user.Name == name
+	})
+}
+
+// UserByMobile
+// @Description: 按手机号查找成员
+func (d *Directory) UserByMobile(mobile string) (user User, ok bool) {
+	users := d.filterUsers(func(user *User) bool {
+		return user.Mobile == mobile
+	})
+	if len(users) == 0 {
+		return User{}, false
+	}
+	return users[0], true
+}
+
+// Department
+// @Description: 按部门id查找部门
+func (d *Directory) Department(id int) (department Department, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if dept, ok := d.departments[id]; ok {
+		return *dept, true
+	}
+	return Department{}, false
+}
+
+// UsersInDepartment
+// @Description: 查找部门及其所有子部门下的成员
+func (d *Directory) UsersInDepartment(id int) (users []User) {
+	d.mu.RLock()
+	subtree := d.subtree(map[int]bool{id: true})
+	d.mu.RUnlock()
+	return d.filterUsers(func(user *User) bool {
+		for _, deptID := range user.Department {
+			if subtree[deptID] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// TagByName
+// @Description: 按名称查找标签
+func (d *Directory) TagByName(tagName string) (tag Tag, ok bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.tags {
+		if t.TagName == tagName {
+			return *t, true
+		}
+	}
+	return Tag{}, false
+}
+
+// UsersByTag
+// @Description: 查找标签下的成员，包括标签中部门及其子部门下的成员
+func (d *Directory) UsersByTag(tagID int) (users []User) {
+	d.mu.RLock()
+	members := map[string]bool{}
+	for userid := range d.tagUsers[tagID] {
+		members[userid] = true
+	}
+	subtree := d.subtree(d.tagParties[tagID])
+	d.mu.RUnlock()
+	return d.filterUsers(func(user *User) bool {
+		if members[user.UserID] {
+			return true
+		}
+		for _, deptID := range user.Department {
+			if subtree[deptID] {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// 计算部门集合及其所有子部门，调用方需持有读锁
+func (d *Directory) subtree(roots map[int]bool) map[int]bool {
+	result := map[int]bool{}
+	for id := range roots {
+		result[id] = true
+	}
+	for changed := true; changed; {
+		changed = false
+		for id, dept := range d.departments {
+			if !result[id] && result[dept.ParentID] {
+				result[id] = true
+				changed = true
+			}
+		}
+	}
+	return result
+}
+
+// 按条件筛选成员，结果按userid排序
+func (d *Directory) filterUsers(match func(user *User) bool) (users []User) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, user := range d.users {
+		if match(user) {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserID < users[j].UserID
+	})
+	return users
+}
+
+// CallbackChangeContact
+// @Description: 处理通讯录变更事件，增量更新本地通讯录缓存
+func CallbackChangeContact(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentChangeContact)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback change contact unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	fmt.Println("callback change contact: ", reqMsgContent.ChangeType)
+	Contacts.Apply(reqMsgContent)
+	return http.StatusOK, nil, nil
+}
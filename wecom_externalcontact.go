@@ -0,0 +1,547 @@
+package main
+
+import (
+	"net/url"
+)
+
+const (
+	ExternalContactBatchLimit = 100  // 批量获取客户详情每页最多条数，userid列表最多100个
+	TransferCustomerMaxCount  = 100  // 离职继承每次最多转接的客户数
+	GroupChatListLimit        = 1000 // 获取客户群列表每页最多条数
+)
+
+// ***客户联系 start***//
+// 配置了客户联系功能的成员列表响应字段
+type FollowUserListResp struct {
+	CommonResp
+	FollowUser []string `json:"follow_user"` // 成员userid列表
+}
+
+// 客户列表响应字段
+type ListExternalContactResp struct {
+	CommonResp
+	ExternalUserID []string `json:"external_userid"` // 外部联系人的userid列表
+}
+
+// 外部联系人
+type ExternalContact struct {
+	ExternalUserID  string           `json:"external_userid"`  // 外部联系人的userid
+	Name            string           `json:"name"`             // 名称，微信用户为微信昵称
+	Position        string           `json:"position"`         // 职位，仅企业微信用户有
+	Avatar          string           `json:"avatar"`           // 头像
+	CorpName        string           `json:"corp_name"`        // 所在企业的简称，仅企业微信用户有
+	CorpFullName    string           `json:"corp_full_name"`   // 所在企业的主体名称，仅企业微信用户有
+	Type            int              `json:"type"`             // 类型：1-微信用户，2-企业微信用户
+	Gender          int              `json:"gender"`           // 性别：0-未知，1-男性，2-女性
+	UnionID         string           `json:"unionid"`          // 微信开放平台的唯一身份标识
+	ExternalProfile *ExternalProfile `json:"external_profile"` // 对外属性，仅企业微信用户有
+}
+
+// 添加了外部联系人的企业成员
+type FollowUser struct {
+	UserID         string          `json:"userid"`           // 成员userid
+	Remark         string          `json:"remark"`           // 成员对客户的备注
+	Description    string          `json:"description"`      // 成员对客户的描述
+	CreateTime     int64           `json:"createtime"`       // 成员添加客户的时间
+	Tags           []FollowUserTag `json:"tags"`             // 成员对客户打的标签，仅获取客户详情接口返回
+	TagID          []string        `json:"tag_id"`           // 成员对客户打的企业标签id，仅批量获取接口返回
+	RemarkCorpName string          `json:"remark_corp_name"` // 成员对客户备注的企业名称
+	RemarkMobiles  []string        `json:"remark_mobiles"`   // 成员对客户备注的手机号码
+	OperUserID     string          `json:"oper_userid"`      // 发起添加的userid
+	AddWay         int             `json:"add_way"`          // 成员添加客户的来源
+	State          string          `json:"state"`            // 添加客户时使用的渠道参数
+	WechatChannels *WechatChannels `json:"wechat_channels"`  // 视频号添加时的视频号信息
+}
+
+// 成员对客户打的标签
+type FollowUserTag struct {
+	GroupName string `json:"group_name"` // 标签的分组名称
+	TagName   string `json:"tag_name"`   // 标签名称
+	TagID     string `json:"tag_id"`     // 企业标签的id，仅type为1时返回
+	Type      int    `json:"type"`       // 标签类型：1-企业设置，2-用户自定义，3-规则组标签
+}
+
+// 视频号信息
+type WechatChannels struct {
+	Nickname string `json:"nickname"` // 视频号名称
+	Source   int    `json:"source"`   // 视频号添加场景：0-未知，1-视频号主页，2-视频号直播间
+}
+
+// 获取客户详情响应字段
+type GetExternalContactResp struct {
+	CommonResp
+	ExternalContact ExternalContact `json:"external_contact"` // 客户信息
+	FollowUser      []FollowUser    `json:"follow_user"`      // 添加了此客户的成员
+	NextCursor      string          `json:"next_cursor"`      // 成员超过500人时分页获取的游标
+}
+
+// 批量获取客户详情请求字段
+type BatchGetExternalContactReq struct {
+	UserIDList []string `json:"userid_list"`      // 成员userid列表，最多100个
+	Cursor     string   `json:"cursor,omitempty"` // 分页游标
+	Limit      int      `json:"limit,omitempty"`  // 每页最多条数，最大100
+}
+
+// 客户详情及其跟进成员
+type ExternalContactDetail struct {
+	ExternalContact ExternalContact `json:"external_contact"` // 客户信息
+	FollowInfo      FollowUser      `json:"follow_info"`      // 跟进成员信息
+}
+
+// 批量获取客户详情响应字段
+type BatchGetExternalContactResp struct {
+	CommonResp
+	ExternalContactList []ExternalContactDetail `json:"external_contact_list"` // 客户列表
+	NextCursor          string                  `json:"next_cursor"`           // 下一页游标，为空表示没有更多数据
+}
+
+// 修改客户备注请求字段
+type RemarkExternalContactReq struct {
+	UserID           string   `json:"userid"`                       // 成员userid
+	ExternalUserID   string   `json:"external_userid"`              // 外部联系人userid
+	Remark           string   `json:"remark,omitempty"`             // 备注信息，最多20个字符
+	Description      string   `json:"description,omitempty"`        // 描述信息，最多150个字符
+	RemarkCompany    string   `json:"remark_company,omitempty"`     // 备注的企业名称，最多20个字符
+	RemarkMobiles    []string `json:"remark_mobiles,omitempty"`     // 备注的手机号，覆盖原有号码
+	RemarkPicMediaID string   `json:"remark_pic_mediaid,omitempty"` // 备注图片的mediaid
+}
+
+// 企业客户标签
+type CorpTag struct {
+	ID         string `json:"id,omitempty"`          // 标签id
+	Name       string `json:"name"`                  // 标签名称
+	CreateTime int64  `json:"create_time,omitempty"` // 创建时间
+	Order      int    `json:"order,omitempty"`       // 排序值，值越大越靠前
+	Deleted    bool   `json:"deleted,omitempty"`     // 是否已经被删除
+}
+
+// 企业客户标签组
+type CorpTagGroup struct {
+	GroupID    string    `json:"group_id,omitempty"`    // 标签组id
+	GroupName  string    `json:"group_name,omitempty"`  // 标签组名称
+	CreateTime int64     `json:"create_time,omitempty"` // 创建时间
+	Order      int       `json:"order,omitempty"`       // 排序值，值越大越靠前
+	Deleted    bool      `json:"deleted,omitempty"`     // 是否已经被删除
+	Tag        []CorpTag `json:"tag"`                   // 标签组内的标签列表
+}
+
+// 企业客户标签请求字段，获取和删除时按标签id或标签组id
+type CorpTagReq struct {
+	TagID   []string `json:"tag_id,omitempty"`   // 标签id列表
+	GroupID []string `json:"group_id,omitempty"` // 标签组id列表
+	AgentID int      `json:"agentid,omitempty"`  // 授权方安装的应用agentid，仅第三方调用时需要
+}
+
+// 企业客户标签列表响应字段
+type CorpTagListResp struct {
+	CommonResp
+	TagGroup []CorpTagGroup `json:"tag_group"` // 标签组列表
+}
+
+// 添加企业客户标签响应字段
+type AddCorpTagResp struct {
+	CommonResp
+	TagGroup CorpTagGroup `json:"tag_group"` // 添加后的标签组
+}
+
+// 编辑企业客户标签请求字段
+type EditCorpTagReq struct {
+	ID    string `json:"id"`              // 标签或标签组的id
+	Name  string `json:"name,omitempty"`  // 新的名称
+	Order int    `json:"order,omitempty"` // 新的排序值
+}
+
+// 编辑客户企业标签请求字段
+type MarkTagReq struct {
+	UserID         string   `json:"userid"`               // 添加外部联系人的成员userid
+	ExternalUserID string   `json:"external_userid"`      // 外部联系人userid
+	AddTag         []string `json:"add_tag,omitempty"`    // 要标记的标签id列表
+	RemoveTag      []string `json:"remove_tag,omitempty"` // 要移除的标签id列表
+}
+
+// 离职继承请求字段
+type TransferCustomerReq struct {
+	HandoverUserID string   `json:"handover_userid"`           // 原跟进成员的userid
+	TakeoverUserID string   `json:"takeover_userid"`           // 接替成员的userid
+	ExternalUserID []string `json:"external_userid,omitempty"` // 客户的external_userid列表，最多100个
+	Cursor         string   `json:"cursor,omitempty"`          // 查询接替结果时的分页游标
+}
+
+// 客户转接结果
+type TransferCustomer struct {
+	ExternalUserID string `json:"external_userid"` // 客户的external_userid
+	ErrCode        int    `json:"errcode"`         // 分配时对此客户的错误码，0表示成功
+	Status         int    `json:"status"`          // 接替状态：1-接替完毕，2-等待接替，3-客户拒绝，4-接替成员客户达到上限，5-无接替记录
+	TakeoverTime   int64  `json:"takeover_time"`   // 接替客户的时间，等待接替时为期望接替时间
+}
+
+// 离职继承响应字段
+type TransferCustomerResp struct {
+	CommonResp
+	Customer   []TransferCustomer `json:"customer"`    // 客户转接结果
+	NextCursor string             `json:"next_cursor"` // 查询接替结果时的下一页游标
+}
+
+// 待分配的离职成员客户
+type UnassignedCustomer struct {
+	HandoverUserID string `json:"handover_userid"` // 离职成员的userid
+	ExternalUserID string `json:"external_userid"` // 外部联系人userid
+	DimissionTime  int64  `json:"dimission_time"`  // 成员离职时间
+}
+
+// 获取待分配的离职成员列表请求字段
+type UnassignedListReq struct {
+	Cursor   string `json:"cursor,omitempty"`    // 分页游标
+	PageSize int    `json:"page_size,omitempty"` // 每页条数，默认1000，最大1000
+}
+
+// 获取待分配的离职成员列表响应字段
+type UnassignedListResp struct {
+	CommonResp
+	Info       []UnassignedCustomer `json:"info"`        // 待分配的客户列表
+	IsLast     bool                 `json:"is_last"`     // 是否是最后一条记录
+	NextCursor string               `json:"next_cursor"` // 下一页游标
+}
+
+// 获取客户群列表请求字段
+type ListGroupChatReq struct {
+	StatusFilter int                   `json:"status_filter"`          // 客户群跟进状态过滤：0-所有，1-离职待继承，2-离职继承中，3-离职继承完成
+	OwnerFilter  *GroupChatOwnerFilter `json:"owner_filter,omitempty"` // 群主过滤，不填为所有群主
+	Cursor       string                `json:"cursor,omitempty"`       // 分页游标
+	Limit        int                   `json:"limit"`                  // 每页最多条数，最大1000
+}
+
+// 客户群群主过滤
+type GroupChatOwnerFilter struct {
+	UserIDList []string `json:"userid_list"` // 群主userid列表，最多100个
+}
+
+// 客户群列表项
+type GroupChatStatus struct {
+	ChatID string `json:"chat_id"` // 客户群id
+	Status int    `json:"status"`  // 客户群跟进状态：0-跟进人正常，1-跟进人离职，2-离职继承中，3-离职继承完成
+}
+
+// 获取客户群列表响应字段
+type ListGroupChatResp struct {
+	CommonResp
+	GroupChatList []GroupChatStatus `json:"group_chat_list"` // 客户群列表
+	NextCursor    string            `json:"next_cursor"`     // 下一页游标，为空表示没有更多数据
+}
+
+// 客户群详情
+type GroupChat struct {
+	ChatID     string            `json:"chat_id"`     // 客户群id
+	Name       string            `json:"name"`        // 群名
+	Owner      string            `json:"owner"`       // 群主userid
+	CreateTime int64             `json:"create_time"` // 群的创建时间
+	Notice     string            `json:"notice"`      // 群公告
+	MemberList []GroupChatMember `json:"member_list"` // 群成员列表
+	AdminList  []GroupChatAdmin  `json:"admin_list"`  // 群管理员列表
+}
+
+// 客户群成员
+type GroupChatMember struct {
+	UserID        string          `json:"userid"`         // 群成员id
+	Type          int             `json:"type"`           // 成员类型：1-企业成员，2-外部联系人
+	UnionID       string          `json:"unionid"`        // 外部联系人在微信开放平台的唯一身份标识
+	JoinTime      int64           `json:"join_time"`      // 入群时间
+	JoinScene     int             `json:"join_scene"`     // 入群方式：1-直接邀请，2-邀请链接，3-扫描群二维码
+	Invitor       *GroupChatAdmin `json:"invitor"`        // 邀请者
+	GroupNickname string          `json:"group_nickname"` // 在群里的昵称
+	Name          string          `json:"name"`           // 名字，需要need_name为1时返回
+}
+
+// 客户群管理员
+type GroupChatAdmin struct {
+	UserID string `json:"userid"` // 成员userid
+}
+
+// 获取客户群详情请求字段
+type GetGroupChatReq struct {
+	ChatID   string `json:"chat_id"`   // 客户群id
+	NeedName int    `json:"need_name"` // 是否需要返回群成员的名字：0-不返回，1-返回
+}
+
+// 获取客户群详情响应字段
+type GetGroupChatResp struct {
+	CommonResp
+	GroupChat GroupChat `json:"group_chat"` // 客户群详情
+}
+
+// ***客户联系 end***//
+
+// GetFollowUserList
+// @Description: 获取配置了客户联系功能的成员列表
+func GetFollowUserList(access_token string) (userids []string, err error) {
+	resp := new(FollowUserListResp)
+	err = GetAPI("/cgi-bin/externalcontact/get_follow_user_list", access_token, nil, resp)
+	return resp.FollowUser, err
+}
+
+// ListExternalContact
+// @Description: 获取成员添加的客户external_userid列表
+func ListExternalContact(access_token string, userid string) (externalUserIDs []string, err error) {
+	resp := new(ListExternalContactResp)
+	err = GetAPI("/cgi-bin/externalcontact/list", access_token, url.Values{"userid": {userid}}, resp)
+	return resp.ExternalUserID, err
+}
+
+// GetExternalContact
+// @Description: 获取客户详情，添加此客户的成员超过500人时用cursor分页获取follow_user
+func GetExternalContact(access_token string, externalUserID string, cursor string) (resp *GetExternalContactResp, err error) {
+	params := url.Values{"external_userid": {externalUserID}}
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	resp = new(GetExternalContactResp)
+	err = GetAPI("/cgi-bin/externalcontact/get", access_token, params, resp)
+	return resp, err
+}
+
+// BatchGetExternalContact
+// @Description: 批量获取成员添加的客户详情，单个成员的每个客户对应一条记录
+func BatchGetExternalContact(access_token string, req *BatchGetExternalContactReq) (resp *BatchGetExternalContactResp, err error) {
+	resp = new(BatchGetExternalContactResp)
+	err = PostAPI("/cgi-bin/externalcontact/batch/get_by_user", access_token, req, resp)
+	return resp, err
+}
+
+// 客户详情分页迭代器
+type ExternalContactIterator struct {
+	cursorPager
+	page []ExternalContactDetail
+}
+
+// IterExternalContacts
+// @Description: 逐条遍历成员添加的客户详情，userids最多100个
+func IterExternalContacts(access_token string, userids []string) *ExternalContactIterator {
+	it := new(ExternalContactIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		resp, err := BatchGetExternalContact(access_token, &BatchGetExternalContactReq{UserIDList: userids, Cursor: cursor, Limit: ExternalContactBatchLimit})
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.ExternalContactList
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *ExternalContactIterator) Next() bool                   { return it.next() }
+func (it *ExternalContactIterator) Value() ExternalContactDetail { return it.page[it.index] }
+func (it *ExternalContactIterator) Err() error                   { return it.err }
+
+// RemarkExternalContact
+// @Description: 修改成员对客户的备注信息
+func RemarkExternalContact(access_token string, req *RemarkExternalContactReq) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/remark", access_token, req, new(CommonResp))
+}
+
+// GetCorpTagList
+// @Description: 获取企业客户标签，tagIDs和groupIDs都为空时返回全部标签
+func GetCorpTagList(access_token string, tagIDs []string, groupIDs []string) (groups []CorpTagGroup, err error) {
+	resp := new(CorpTagListResp)
+	err = PostAPI("/cgi-bin/externalcontact/get_corp_tag_list", access_token, CorpTagReq{TagID: tagIDs, GroupID: groupIDs}, resp)
+	return resp.TagGroup, err
+}
+
+// AddCorpTag
+// @Description: 添加企业客户标签，填写group_id时添加到已有标签组，否则按group_name创建标签组
+func AddCorpTag(access_token string, group *CorpTagGroup) (created *CorpTagGroup, err error) {
+	resp := new(AddCorpTagResp)
+	err = PostAPI("/cgi-bin/externalcontact/add_corp_tag", access_token, group, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.TagGroup, nil
+}
+
+// EditCorpTag
+// @Description: 修改企业客户标签或标签组的名称和排序
+func EditCorpTag(access_token string, req *EditCorpTagReq) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/edit_corp_tag", access_token, req, new(CommonResp))
+}
+
+// DelCorpTag
+// @Description: 删除企业客户标签，删除标签组时会删除组内全部标签
+func DelCorpTag(access_token string, tagIDs []string, groupIDs []string) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/del_corp_tag", access_token, CorpTagReq{TagID: tagIDs, GroupID: groupIDs}, new(CommonResp))
+}
+
+// FindCorpTagByName
+// @Description: 按标签组名称和标签名称查找企业客户标签id，groupName为空时在所有标签组中查找
+func FindCorpTagByName(access_token string, groupName string, tagName string) (tagID string, ok bool, err error) {
+	groups, err := GetCorpTagList(access_token, nil, nil)
+	if err != nil {
+		return "", false, err
+	}
+	for _, group := range groups {
+		if groupName != "" && group.GroupName != groupName {
+			continue
+		}
+		for _, tag := range group.Tag {
+			if tag.Name == tagName {
+				return tag.ID, true, nil
+			}
+		}
+	}
+	return "", false, nil
+}
+
+// MarkTag
+// @Description: 编辑客户的企业标签
+func MarkTag(access_token string, req *MarkTagReq) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/mark_tag", access_token, req, new(CommonResp))
+}
+
+// TransferResignedCustomer
+// @Description: 将离职成员的客户分配给接替成员，超过100个客户时分批分配，返回每个客户的分配结果
+func TransferResignedCustomer(access_token string, handoverUserID string, takeoverUserID string, externalUserIDs []string) (customers []TransferCustomer, err error) {
+	for start := 0; start < len(externalUserIDs); start += TransferCustomerMaxCount {
+		end := start + TransferCustomerMaxCount
+		if end > len(externalUserIDs) {
+			end = len(externalUserIDs)
+		}
+		resp := new(TransferCustomerResp)
+		err = PostAPI("/cgi-bin/externalcontact/resigned/transfer_customer", access_token, TransferCustomerReq{
+			HandoverUserID: handoverUserID,
+			TakeoverUserID: takeoverUserID,
+			ExternalUserID: externalUserIDs[start:end],
+		}, resp)
+		if err != nil {
+			return customers, err
+		}
+		customers = append(customers, resp.Customer...)
+	}
+	return customers, nil
+}
+
+// GetResignedTransferResult
+// @Description: 查询离职继承的客户接替状态
+func GetResignedTransferResult(access_token string, handoverUserID string, takeoverUserID string, cursor string) (resp *TransferCustomerResp, err error) {
+	resp = new(TransferCustomerResp)
+	err = PostAPI("/cgi-bin/externalcontact/resigned/transfer_result", access_token, TransferCustomerReq{
+		HandoverUserID: handoverUserID,
+		TakeoverUserID: takeoverUserID,
+		Cursor:         cursor,
+	}, resp)
+	return resp, err
+}
+
+// 客户接替状态分页迭代器
+type TransferResultIterator struct {
+	cursorPager
+	page []TransferCustomer
+}
+
+// IterResignedTransferResult
+// @Description: 逐条遍历离职继承的客户接替状态
+func IterResignedTransferResult(access_token string, handoverUserID string, takeoverUserID string) *TransferResultIterator {
+	it := new(TransferResultIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		resp, err := GetResignedTransferResult(access_token, handoverUserID, takeoverUserID, cursor)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.Customer
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *TransferResultIterator) Next() bool              { return it.next() }
+func (it *TransferResultIterator) Value() TransferCustomer { return it.page[it.index] }
+func (it *TransferResultIterator) Err() error              { return it.err }
+
+// GetUnassignedList
+// @Description: 获取待分配的离职成员的客户列表
+func GetUnassignedList(access_token string, cursor string, pageSize int) (resp *UnassignedListResp, err error) {
+	resp = new(UnassignedListResp)
+	err = PostAPI("/cgi-bin/externalcontact/get_unassigned_list", access_token, UnassignedListReq{Cursor: cursor, PageSize: pageSize}, resp)
+	return resp, err
+}
+
+// 待分配客户分页迭代器
+type UnassignedCustomerIterator struct {
+	cursorPager
+	page []UnassignedCustomer
+}
+
+// IterUnassignedCustomers
+// @Description: 逐条遍历待分配的离职成员的客户
+func IterUnassignedCustomers(access_token string) *UnassignedCustomerIterator {
+	it := new(UnassignedCustomerIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		resp, err := GetUnassignedList(access_token, cursor, 1000)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.Info
+		if resp.IsLast {
+			return len(it.page), "", nil
+		}
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *UnassignedCustomerIterator) Next() bool                { return it.next() }
+func (it *UnassignedCustomerIterator) Value() UnassignedCustomer { return it.page[it.index] }
+func (it *UnassignedCustomerIterator) Err() error                { return it.err }
+
+// ListGroupChat
+// @Description: 获取客户群列表
+func ListGroupChat(access_token string, req *ListGroupChatReq) (resp *ListGroupChatResp, err error) {
+	if req.Limit == 0 {
+		req.Limit = GroupChatListLimit
+	}
+	resp = new(ListGroupChatResp)
+	err = PostAPI("/cgi-bin/externalcontact/groupchat/list", access_token, req, resp)
+	return resp, err
+}
+
+// 客户群分页迭代器
+type GroupChatIterator struct {
+	cursorPager
+	page []GroupChatStatus
+}
+
+// IterGroupChats
+// @Description: 逐条遍历客户群，filter为空时遍历所有群主的全部客户群
+func IterGroupChats(access_token string, statusFilter int, ownerUserIDs []string) *GroupChatIterator {
+	req := &ListGroupChatReq{StatusFilter: statusFilter}
+	if len(ownerUserIDs) > 0 {
+		req.OwnerFilter = &GroupChatOwnerFilter{UserIDList: ownerUserIDs}
+	}
+	it := new(GroupChatIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		req.Cursor = cursor
+		resp, err := ListGroupChat(access_token, req)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.GroupChatList
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *GroupChatIterator) Next() bool             { return it.next() }
+func (it *GroupChatIterator) Value() GroupChatStatus { return it.page[it.index] }
+func (it *GroupChatIterator) Err() error             { return it.err }
+
+// GetGroupChat
+// @Description: 获取客户群详情，needName为true时返回群成员的名字
+func GetGroupChat(access_token string, chatid string, needName bool) (chat *GroupChat, err error) {
+	req := GetGroupChatReq{ChatID: chatid}
+	if needName {
+		req.NeedName = 1
+	}
+	resp := new(GetGroupChatResp)
+	err = PostAPI("/cgi-bin/externalcontact/groupchat/get", access_token, req, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.GroupChat, nil
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+// 欢迎语需要在收到添加客户事件后20秒内发送
+const WelcomeCodeTTL = 20 * time.Second
+
+// ***客户联系回调事件 start***//
+// 企业微信回调客户变更事件解密后的数据
+// ChangeType: add_external_contact、edit_external_contact、add_half_external_contact、del_external_contact、del_follow_user、transfer_fail
+type ReqMsgContentChangeExternalContact struct {
+	CallbackEventCommon
+	UserID         string `xml:"UserID"`         // 企业服务人员的UserID
+	ExternalUserID string `xml:"ExternalUserID"` // 外部联系人的userid
+	State          string `xml:"State"`          // 添加此客户的渠道参数，仅添加客户时有
+	WelcomeCode    string `xml:"WelcomeCode"`    // 欢迎语code，仅添加客户时有，20秒内有效
+	Source         string `xml:"Source"`         // 删除客户的操作来源，DELETE_BY_TRANSFER表示成员在职继承时自动删除
+	FailReason     string `xml:"FailReason"`     // 接替失败的原因：customer_refused-客户拒绝，customer_limit_exceed-接替成员的客户数达到上限
+}
+
+// 企业微信回调客户群变更事件解密后的数据
+// ChangeType: create、update、dismiss
+type ReqMsgContentChangeExternalChat struct {
+	CallbackEventCommon
+	ChatID        string   `xml:"ChatId"`             // 客户群id
+	UpdateDetail  string   `xml:"UpdateDetail"`       // 变更详情：add_member、del_member、change_owner、change_name、change_notice
+	JoinScene     int      `xml:"JoinScene"`          // 成员入群方式：0-由成员邀请入群，3-通过扫描群二维码入群
+	QuitScene     int      `xml:"QuitScene"`          // 成员退群方式：0-自己退群，1-群主/群管理员移出
+	MemChangeCnt  int      `xml:"MemChangeCnt"`       // 成员变更数量
+	MemChangeList []string `xml:"MemChangeList>Item"` // 变更的成员列表
+	LastMemVer    string   `xml:"LastMemVer"`         // 变更前的群成员版本号
+	CurMemVer     string   `xml:"CurMemVer"`          // 变更后的群成员版本号
+}
+
+// 企业微信回调企业客户标签变更事件解密后的数据
+// ChangeType: create、update、delete、shuffle
+type ReqMsgContentChangeExternalTag struct {
+	CallbackEventCommon
+	ID         string `xml:"Id"`         // 标签或标签组的id
+	TagType    string `xml:"TagType"`    // 类型：tag-标签，tag_group-标签组
+	StrategyID int    `xml:"StrategyId"` // 规则组id，规则组标签变更时有
+}
+
+// ***客户联系回调事件 end***//
+
+// ***欢迎语 start***//
+// 发送新客户欢迎语请求字段，text和attachments不能同时为空
+type WelcomeMsg struct {
+	WelcomeCode string       `json:"welcome_code"`          // 添加客户事件中的WelcomeCode
+	Text        *Text        `json:"text,omitempty"`        // 文本消息
+	Attachments []Attachment `json:"attachments,omitempty"` // 附件，最多9个
+}
+
+// 客户消息附件，按msgtype填写对应的内容
+type Attachment struct {
+	MsgType     string                 `json:"msgtype"`               // 附件类型：image、link、miniprogram、video、file
+	Image       *AttachmentImage       `json:"image,omitempty"`       // 图片
+	Link        *AttachmentLink        `json:"link,omitempty"`        // 图文消息
+	MiniProgram *AttachmentMiniProgram `json:"miniprogram,omitempty"` // 小程序消息
+	Video       *Media                 `json:"video,omitempty"`       // 视频
+	File        *Media                 `json:"file,omitempty"`        // 文件
+}
+
+// 图片附件，media_id和pic_url二选一
+type AttachmentImage struct {
+	MediaID string `json:"media_id,omitempty"` // 图片的media_id
+	PicURL  string `json:"pic_url,omitempty"`  // 图片的链接，仅可使用上传图片接口得到的链接
+}
+
+// 图文消息附件
+type AttachmentLink struct {
+	Title  string `json:"title"`            // 图文消息标题，最长128个字节
+	PicURL string `json:"picurl,omitempty"` // 图文消息封面的url
+	Desc   string `json:"desc,omitempty"`   // 图文消息的描述，最长512个字节
+	URL    string `json:"url"`              // 图文消息的链接
+}
+
+// 小程序消息附件
+type AttachmentMiniProgram struct {
+	Title      string `json:"title"`        // 小程序消息标题，最长64个字节
+	PicMediaID string `json:"pic_media_id"` // 小程序消息封面的media_id
+	AppID      string `json:"appid"`        // 小程序appid，必须是关联到企业的小程序应用
+	Page       string `json:"page"`         // 小程序page路径
+}
+
+// ***欢迎语 end***//
+
+// 客户变更事件处理函数
+type ExternalContactEventHandler func(event *ReqMsgContentChangeExternalContact)
+
+// 客户群变更事件处理函数
+type ExternalChatEventHandler func(event *ReqMsgContentChangeExternalChat)
+
+// 企业客户标签变更事件处理函数
+type ExternalTagEventHandler func(event *ReqMsgContentChangeExternalTag)
+
+// 生成欢迎语，返回nil表示不发送，welcome_code由调用方自动填写
+type WelcomeMsgBuilder func(event *ReqMsgContentChangeExternalContact) *WelcomeMsg
+
+var (
+	externalEventMu         sync.RWMutex
+	externalContactHandlers = map[string][]ExternalContactEventHandler{} // ChangeType到处理函数
+	externalChatHandlers    = map[string][]ExternalChatEventHandler{}    // ChangeType到处理函数
+	externalTagHandlers     = map[string][]ExternalTagEventHandler{}     // ChangeType到处理函数
+	welcomeMsgBuilder       WelcomeMsgBuilder
+)
+
+func init() {
+	RegisterEventHandler("change_external_contact", CallbackChangeExternalContact)
+	RegisterEventHandler("change_external_chat", CallbackChangeExternalChat)
+	RegisterEventHandler("change_external_tag", CallbackChangeExternalTag)
+}
+
+// OnExternalContactEvent
+// @Description: 注册客户变更事件处理函数，changeType如add_external_contact、del_follow_user
+func OnExternalContactEvent(changeType string, handler ExternalContactEventHandler) {
+	externalEventMu.Lock()
+	defer externalEventMu.Unlock()
+	externalContactHandlers[changeType] = append(externalContactHandlers[changeType], handler)
+}
+
+// OnExternalChatEvent
+// @Description: 注册客户群变更事件处理函数，changeType为create、update、dismiss
+func OnExternalChatEvent(changeType string, handler ExternalChatEventHandler) {
+	externalEventMu.Lock()
+	defer externalEventMu.Unlock()
+	externalChatHandlers[changeType] = append(externalChatHandlers[changeType], handler)
+}
+
+// OnExternalTagEvent
+// @Description: 注册企业客户标签变更事件处理函数，changeType为create、update、delete、shuffle
+func OnExternalTagEvent(changeType string, handler ExternalTagEventHandler) {
+	externalEventMu.Lock()
+	defer externalEventMu.Unlock()
+	externalTagHandlers[changeType] = append(externalTagHandlers[changeType], handler)
+}
+
+// SetWelcomeMsgBuilder
+// @Description: 设置新客户欢迎语，添加客户事件带有WelcomeCode时自动发送
+func SetWelcomeMsgBuilder(builder WelcomeMsgBuilder) {
+	externalEventMu.Lock()
+	defer externalEventMu.Unlock()
+	welcomeMsgBuilder = builder
+}
+
+// SendWelcomeMsg
+// @Description: 发送新客户欢迎语，需要在收到添加客户事件后20秒内调用，且每个WelcomeCode只能使用一次
+func SendWelcomeMsg(access_token string, msg *WelcomeMsg) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/send_welcome_msg", access_token, msg, new(CommonResp))
+}
+
+// CallbackChangeExternalContact
+// @Description: 处理客户变更事件，先发送欢迎语再异步调用注册的处理函数，回调需要在5秒内响应
+func CallbackChangeExternalContact(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentChangeExternalContact)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback change external contact unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	fmt.Println("callback change external contact: ", reqMsgContent.ChangeType, reqMsgContent.UserID, reqMsgContent.ExternalUserID)
+
+	externalEventMu.RLock()
+	handlers := externalContactHandlers[reqMsgContent.ChangeType]
+	builder := welcomeMsgBuilder
+	externalEventMu.RUnlock()
+
+	safeGo("change external contact", func() {
+		if reqMsgContent.WelcomeCode != "" && builder != nil {
+			sendWelcomeMsg(reqMsgContent, builder)
+		}
+		for _, handler := range handlers {
+			handler(reqMsgContent)
+		}
+	})
+	return http.StatusOK, nil, nil
+}
+
+// 生成并发送欢迎语，超过WelcomeCode有效期时放弃发送
+func sendWelcomeMsg(event *ReqMsgContentChangeExternalContact, builder WelcomeMsgBuilder) {
+	deadline := time.Unix(int64(event.CreateTime), 0).Add(WelcomeCodeTTL)
+	welcome := builder(event)
+	if welcome == nil {
+		return
+	}
+	if time.Now().After(deadline) {
+		fmt.Println("send welcome msg err: welcome_code expired, external_userid: ", event.ExternalUserID)
+		return
+	}
+	welcome.WelcomeCode = event.WelcomeCode
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		return
+	}
+	if err = SendWelcomeMsg(access_token, welcome); err != nil {
+		fmt.Println("send welcome msg err: ", err)
+	}
+}
+
+// CallbackChangeExternalChat
+// @Description: 处理客户群变更事件，异步调用注册的处理函数
+func CallbackChangeExternalChat(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentChangeExternalChat)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback change external chat unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	fmt.Println("callback change external chat: ", reqMsgContent.ChangeType, reqMsgContent.ChatID, reqMsgContent.UpdateDetail)
+
+	externalEventMu.RLock()
+	handlers := externalChatHandlers[reqMsgContent.ChangeType]
+	externalEventMu.RUnlock()
+	safeGo("change external chat", func() {
+		for _, handler := range handlers {
+			handler(reqMsgContent)
+		}
+	})
+	return http.StatusOK, nil, nil
+}
+
+// CallbackChangeExternalTag
+// @Description: 处理企业客户标签变更事件，异步调用注册的处理函数
+func CallbackChangeExternalTag(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentChangeExternalTag)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback change external tag unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	fmt.Println("callback change external tag: ", reqMsgContent.ChangeType, reqMsgContent.TagType, reqMsgContent.ID)
+
+	externalEventMu.RLock()
+	handlers := externalTagHandlers[reqMsgContent.ChangeType]
+	externalEventMu.RUnlock()
+	safeGo("change external tag", func() {
+		for _, handler := range handlers {
+			handler(reqMsgContent)
+		}
+	})
+	return http.StatusOK, nil, nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+const (
+	GroupMsgChatTypeSingle = "single" // 发送给客户
+	GroupMsgChatTypeGroup  = "group"  // 发送给客户群
+	GroupMsgListLimit      = 100      // 群发记录分页每页最多条数
+	GroupMsgResultLimit    = 1000     // 群发任务和发送结果分页每页最多条数
+	AttachmentMaxCount     = 9        // 群发和欢迎语最多附件数
+)
+
+// ***客户群发 start***//
+// 创建企业群发请求字段
+type AddMsgTemplateReq struct {
+	ChatType       string          `json:"chat_type,omitempty"`       // 群发任务的类型：single-发送给客户，group-发送给客户群，默认为single
+	ExternalUserID []string        `json:"external_userid,omitempty"` // 客户的外部联系人id列表，仅single类型有效，最多1万个
+	ChatIDList     []string        `json:"chat_id_list,omitempty"`    // 客户群id列表，仅group类型有效，最多2000个
+	TagFilter      *GroupMsgFilter `json:"tag_filter,omitempty"`      // 要进行群发的客户标签列表，同组标签之间按或关系，不同组之间按且关系
+	Sender         string          `json:"sender,omitempty"`          // 发送企业群发消息的成员userid，group类型必填
+	AllowSelect    bool            `json:"allow_select,omitempty"`    // 是否允许成员在待发送客户列表中重新选择
+	Text           *Text           `json:"text,omitempty"`            // 文本消息
+	Attachments    []Attachment    `json:"attachments,omitempty"`     // 附件，最多9个
+}
+
+// 群发客户标签过滤
+type GroupMsgFilter struct {
+	GroupList []GroupMsgTagList `json:"group_list"` // 标签组列表
+}
+
+// 群发客户标签过滤中的一组标签
+type GroupMsgTagList struct {
+	TagList []string `json:"tag_list"` // 企业客户标签id列表
+}
+
+// 创建企业群发响应字段
+type AddMsgTemplateResp struct {
+	CommonResp
+	FailList []string `json:"fail_list"` // 无效或无法发送的external_userid列表
+	MsgID    string   `json:"msgid"`     // 企业群发消息的id
+}
+
+// 获取群发记录列表请求字段
+type GroupMsgListReq struct {
+	ChatType   string `json:"chat_type"`         // 群发任务的类型：single、group
+	StartTime  int64  `json:"start_time"`        // 群发任务记录开始时间
+	EndTime    int64  `json:"end_time"`          // 群发任务记录结束时间，与开始时间间隔不超过1个月
+	Creator    string `json:"creator,omitempty"` // 群发任务创建人userid
+	FilterType int    `json:"filter_type"`       // 创建人类型：0-企业发表，1-个人发表，2-所有
+	Limit      int    `json:"limit,omitempty"`   // 每页最多条数，最大100
+	Cursor     string `json:"cursor,omitempty"`  // 分页游标
+}
+
+// 群发记录
+type GroupMsg struct {
+	MsgID       string       `json:"msgid"`       // 企业群发消息的id
+	Creator     string       `json:"creator"`     // 群发消息创建者userid
+	CreateTime  string       `json:"create_time"` // 创建时间
+	CreateType  int          `json:"create_type"` // 群发消息创建来源：0-企业，1-个人
+	Text        *Text        `json:"text"`        // 文本消息
+	Attachments []Attachment `json:"attachments"` // 附件
+}
+
+// 获取群发记录列表响应字段
+type GroupMsgListResp struct {
+	CommonResp
+	NextCursor   string     `json:"next_cursor"`    // 下一页游标，为空表示没有更多数据
+	GroupMsgList []GroupMsg `json:"group_msg_list"` // 群发记录列表
+}
+
+// 获取群发成员执行结果请求字段
+type GroupMsgResultReq struct {
+	MsgID  string `json:"msgid"`            // 群发消息的id
+	UserID string `json:"userid,omitempty"` // 发送成员userid，获取发送结果时必填
+	Limit  int    `json:"limit,omitempty"`  // 每页最多条数，最大1000
+	Cursor string `json:"cursor,omitempty"` // 分页游标
+}
+
+// 群发成员发送任务
+type GroupMsgTask struct {
+	UserID   string `json:"userid"`    // 企业服务人员的userid
+	Status   int    `json:"status"`    // 发送状态：0-未发送，2-已发送
+	SendTime int64  `json:"send_time"` // 发送时间，未发送时不返回
+}
+
+// 获取群发成员发送任务列表响应字段
+type GroupMsgTaskResp struct {
+	CommonResp
+	NextCursor string         `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
+	TaskList   []GroupMsgTask `json:"task_list"`   // 发送任务列表
+}
+
+// 群发消息的发送结果
+type GroupMsgSendResult struct {
+	ExternalUserID string `json:"external_userid"` // 外部联系人userid，群发给客户群时不返回
+	ChatID         string `json:"chat_id"`         // 客户群id，群发给客户时不返回
+	UserID         string `json:"userid"`          // 企业服务人员的userid
+	Status         int    `json:"status"`          // 发送状态：0-未发送，1-已发送，2-因客户不是好友导致发送失败，3-因客户已经收到其他群发消息导致发送失败
+	SendTime       int64  `json:"send_time"`       // 发送时间，发送状态为1时返回
+}
+
+// 获取群发消息的发送结果响应字段
+type GroupMsgSendResultResp struct {
+	CommonResp
+	NextCursor string               `json:"next_cursor"` // 下一页游标，为空表示没有更多数据
+	SendList   []GroupMsgSendResult `json:"send_list"`   // 发送结果列表
+}
+
+// 群发消息id请求字段
+type GroupMsgIDReq struct {
+	MsgID string `json:"msgid"` // 群发消息的id
+}
+
+// ***客户群发 end***//
+
+// AddMsgTemplate
+// @Description: 创建企业群发，成员确认后才会发送给客户，返回群发消息id和无法发送的客户
+func AddMsgTemplate(access_token string, req *AddMsgTemplateReq) (resp *AddMsgTemplateResp, err error) {
+	if len(req.Attachments) > AttachmentMaxCount {
+		return nil, errors.New("too many attachments: " + strconv.Itoa(len(req.Attachments)))
+	}
+	resp = new(AddMsgTemplateResp)
+	err = PostAPI("/cgi-bin/externalcontact/add_msg_template", access_token, req, resp)
+	return resp, err
+}
+
+// GetGroupMsgList
+// @Description: 获取群发记录列表
+func GetGroupMsgList(access_token string, req *GroupMsgListReq) (resp *GroupMsgListResp, err error) {
+	resp = new(GroupMsgListResp)
+	err = PostAPI("/cgi-bin/externalcontact/get_groupmsg_list_v2", access_token, req, resp)
+	return resp, err
+}
+
+// 群发记录分页迭代器
+type GroupMsgIterator struct {
+	cursorPager
+	page []GroupMsg
+}
+
+// IterGroupMsgs
+// @Description: 逐条遍历群发记录
+func IterGroupMsgs(access_token string, req *GroupMsgListReq) *GroupMsgIterator {
+	it := new(GroupMsgIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		pageReq := *req
+		pageReq.Cursor = cursor
+		if pageReq.Limit == 0 {
+			pageReq.Limit = GroupMsgListLimit
+		}
+		resp, err := GetGroupMsgList(access_token, &pageReq)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.GroupMsgList
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *GroupMsgIterator) Next() bool      { return it.next() }
+func (it *GroupMsgIterator) Value() GroupMsg { return it.page[it.index] }
+func (it *GroupMsgIterator) Err() error      { return it.err }
+
+// GetGroupMsgTask
+// @Description: 获取群发成员发送任务列表
+func GetGroupMsgTask(access_token string, msgid string, cursor string) (resp *GroupMsgTaskResp, err error) {
+	resp = new(GroupMsgTaskResp)
+	err = PostAPI("/cgi-bin/externalcontact/get_groupmsg_task", access_token, GroupMsgResultReq{MsgID: msgid, Limit: GroupMsgResultLimit, Cursor: cursor}, resp)
+	return resp, err
+}
+
+// 群发成员发送任务分页迭代器
+type GroupMsgTaskIterator struct {
+	cursorPager
+	page []GroupMsgTask
+}
+
+// IterGroupMsgTasks
+// @Description: 逐条遍历群发成员发送任务
+func IterGroupMsgTasks(access_token string, msgid string) *GroupMsgTaskIterator {
+	it := new(GroupMsgTaskIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		resp, err := GetGroupMsgTask(access_token, msgid, cursor)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.TaskList
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *GroupMsgTaskIterator) Next() bool          { return it.next() }
+func (it *GroupMsgTaskIterator) Value() GroupMsgTask { return it.page[it.index] }
+func (it *GroupMsgTaskIterator) Err() error          { return it.err }
+
+// GetGroupMsgSendResult
+// @Description: 获取企业群发成员执行结果
+func GetGroupMsgSendResult(access_token string, msgid string, userid string, cursor string) (resp *GroupMsgSendResultResp, err error) {
+	resp = new(GroupMsgSendResultResp)
+	err = PostAPI("/cgi-bin/externalcontact/get_groupmsg_send_result", access_token, GroupMsgResultReq{MsgID: msgid, UserID: userid, Limit: GroupMsgResultLimit, Cursor: cursor}, resp)
+	return resp, err
+}
+
+// 群发发送结果分页迭代器
+type GroupMsgSendResultIterator struct {
+	cursorPager
+	page []GroupMsgSendResult
+}
+
+// IterGroupMsgSendResults
+// @Description: 逐条遍历成员的群发发送结果
+func IterGroupMsgSendResults(access_token string, msgid string, userid string) *GroupMsgSendResultIterator {
+	it := new(GroupMsgSendResultIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		resp, err := GetGroupMsgSendResult(access_token, msgid, userid, cursor)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.SendList
+		return len(it.page), resp.NextCursor, nil
+	})
+	return it
+}
+
+func (it *GroupMsgSendResultIterator) Next() bool                { return it.next() }
+func (it *GroupMsgSendResultIterator) Value() GroupMsgSendResult { return it.page[it.index] }
+func (it *GroupMsgSendResultIterator) Err() error                { return it.err }
+
+// ListGroupMsgSendResults
+// @Description: 汇总群发消息在全部成员下的发送结果
+func ListGroupMsgSendResults(access_token string, msgid string) (results []GroupMsgSendResult, err error) {
+	tasks := IterGroupMsgTasks(access_token, msgid)
+	for tasks.Next() {
+		sendResults := IterGroupMsgSendResults(access_token, msgid, tasks.Value().UserID)
+		for sendResults.Next() {
+			results = append(results, sendResults.Value())
+		}
+		if err = sendResults.Err(); err != nil {
+			return results, err
+		}
+	}
+	return results, tasks.Err()
+}
+
+// CancelGroupMsgSend
+// @Description: 停止企业群发，成员未发送的部分不再发送
+func CancelGroupMsgSend(access_token string, msgid string) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/cancel_groupmsg_send", access_token, GroupMsgIDReq{MsgID: msgid}, new(CommonResp))
+}
+
+// RemindGroupMsgSend
+// @Description: 提醒成员发送企业群发，每个群发每天最多提醒三次
+func RemindGroupMsgSend(access_token string, msgid string) (err error) {
+	return PostAPI("/cgi-bin/externalcontact/remind_groupmsg_send", access_token, GroupMsgIDReq{MsgID: msgid}, new(CommonResp))
+}
+
+// NewImageAttachment
+// @Description: 上传图片并生成图片附件
+func NewImageAttachment(access_token string, fileName string, file io.Reader, size int64) (attachment Attachment, err error) {
+	uploadResp, err := UploadMedia(access_token, "image", fileName, file, size)
+	if err != nil {
+		return attachment, err
+	}
+	return Attachment{MsgType: "image", Image: &AttachmentImage{MediaID: uploadResp.MediaID}}, nil
+}
+
+// NewLinkAttachment
+// @Description: 生成图文消息附件
+func NewLinkAttachment(title string, picURL string, desc string, link string) Attachment {
+	return Attachment{MsgType: "link", Link: &AttachmentLink{Title: title, PicURL: picURL, Desc: desc, URL: link}}
+}
+
+// NewMiniProgramAttachment
+// @Description: 上传封面图片并生成小程序消息附件，封面建议尺寸为520*416
+func NewMiniProgramAttachment(access_token string, title string, appid string, page string, picName string, pic io.Reader, size int64) (attachment Attachment, err error) {
+	uploadResp, err := UploadMedia(access_token, "image", picName, pic, size)
+	if err != nil {
+		return attachment, err
+	}
+	return Attachment{MsgType: "miniprogram", MiniProgram: &AttachmentMiniProgram{
+		Title:      title,
+		PicMediaID: uploadResp.MediaID,
+		AppID:      appid,
+		Page:       page,
+	}}, nil
+}
+
+// NewVideoAttachment
+// @Description: 上传视频并生成视频附件
+func NewVideoAttachment(access_token string, fileName string, file io.Reader, size int64) (attachment Attachment, err error) {
+	uploadResp, err := UploadMedia(access_token, "video", fileName, file, size)
+	if err != nil {
+		return attachment, err
+	}
+	return Attachment{MsgType: "video", Video: &Media{MediaID: uploadResp.MediaID}}, nil
+}
+
+// NewFileAttachment
+// @Description: 上传文件并生成文件附件
+func NewFileAttachment(access_token string, fileName string, file io.Reader, size int64) (attachment Attachment, err error) {
+	uploadResp, err := UploadMedia(access_token, "file", fileName, file, size)
+	if err != nil {
+		return attachment, err
+	}
+	return Attachment{MsgType: "file", File: &Media{MediaID: uploadResp.MediaID}}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ***JS-SDK start***//
+// 获取jsapi_ticket响应字段
+type JSAPITicketResp struct {
+	CommonResp
+	Ticket    string `json:"ticket"`     // 临时票据
+	ExpiresIn int    `json:"expires_in"` // 有效期（秒）
+}
+
+// wx.config和wx.agentConfig的签名参数
+type JSSDKSignature struct {
+	CorpID    string `json:"corpid"`            // 企业id
+	AgentID   int    `json:"agentid,omitempty"` // 应用id，仅wx.agentConfig需要
+	Timestamp int64  `json:"timestamp"`         // 生成签名的时间戳
+	NonceStr  string `json:"nonceStr"`          // 生成签名的随机串
+	Signature string `json:"signature"`         // 签名
+}
+
+// JS-SDK签名配置
+type JSSDKConfig struct {
+	Config      JSSDKSignature `json:"config"`       // wx.config使用的企业签名
+	AgentConfig JSSDKSignature `json:"agent_config"` // wx.agentConfig使用的应用签名
+}
+
+// ***JS-SDK end***//
+
+// GetJSAPITicket
+// @Description: 获取企业的jsapi_ticket，按corpid缓存，有效期内重复获取直接返回缓存
+func GetJSAPITicket(access_token string, corpid string) (ticket string, err error) {
+	return Tokens.Get("jsapi_ticket:"+corpid, func() (string, int, error) {
+		resp := new(JSAPITicketResp)
+		if err := GetAPI("/cgi-bin/get_jsapi_ticket", access_token, nil, resp); err != nil {
+			return "", 0, err
+		}
+		return resp.Ticket, resp.ExpiresIn, nil
+	})
+}
+
+// GetAgentTicket
+// @Description: 获取应用的jsapi_ticket，按corpid和agentid缓存
+func GetAgentTicket(access_token string, corpid string, agentid int) (ticket string, err error) {
+	return Tokens.Get("agent_ticket:"+corpid+":"+strconv.Itoa(agentid), func() (string, int, error) {
+		resp := new(JSAPITicketResp)
+		if err := GetAPI("/cgi-bin/ticket/get", access_token, url.Values{"type": {"agent_config"}}, resp); err != nil {
+			return "", 0, err
+		}
+		return resp.Ticket, resp.ExpiresIn, nil
+	})
+}
+
+// SignJSSDK
+// @Description: 按JS-SDK签名算法计算签名，pageURL中#及其后面的部分不参与签名
+func SignJSSDK(ticket string, nonceStr string, timestamp int64, pageURL string) string {
+	if i := strings.Index(pageURL, "#"); i >= 0 {
+		pageURL = pageURL[:i]
+	}
+	raw := "jsapi_ticket=" + ticket + "&noncestr=" + nonceStr + "&timestamp=" + strconv.FormatInt(timestamp, 10) + "&url=" + pageURL
+	sum := sha1.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// GetJSSDKConfig
+// @Description: 生成当前自建应用在pageURL页面上的wx.config和wx.agentConfig签名
+func GetJSSDKConfig(pageURL string) (config *JSSDKConfig, err error) {
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	corpTicket, err := GetJSAPITicket(access_token, CorpID)
+	if err != nil {
+		return nil, err
+	}
+	agentTicket, err := GetAgentTicket(access_token, CorpID, AgentID)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 8)
+	if _, err = rand.Read(b); err != nil {
+		return nil, err
+	}
+	nonceStr := hex.EncodeToString(b)
+	timestamp := time.Now().Unix()
+	return &JSSDKConfig{
+		Config: JSSDKSignature{
+			CorpID:    CorpID,
+			Timestamp: timestamp,
+			NonceStr:  nonceStr,
+			Signature: SignJSSDK(corpTicket, nonceStr, timestamp, pageURL),
+		},
+		AgentConfig: JSSDKSignature{
+			CorpID:    CorpID,
+			AgentID:   AgentID,
+			Timestamp: timestamp,
+			NonceStr:  nonceStr,
+			Signature: SignJSSDK(agentTicket, nonceStr, timestamp, pageURL),
+		},
+	}, nil
+}
+
+// RelayJSSDKConfig
+// @Description: 返回url参数对应页面的JS-SDK签名配置
+func RelayJSSDKConfig(c *gin.Context) {
+	pageURL := c.Query("url")
+	if pageURL == "" {
+		ResponseJSON(c, http.StatusBadRequest, 1, "url is required", nil)
+		return
+	}
+	config, err := GetJSSDKConfig(pageURL)
+	if err != nil {
+		ResponseJSON(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, 0, "ok", config)
+}
@@ -0,0 +1,554 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+const (
+	kfCursorKeyPrefix = "kf_cursor:" // 微信客服消息同步游标在存储中的key前缀
+	KfSyncMsgLimit    = 1000         // 每次拉取的消息条数上限
+)
+
+// 会话状态
+const (
+	KfServiceStateUntreated = 0 // 未处理，新会话接入
+	KfServiceStateBot       = 1 // 由智能助手接待
+	KfServiceStateQueue     = 2 // 待接入池排队中
+	KfServiceStateServicer  = 3 // 由人工接待
+	KfServiceStateEnded     = 4 // 已结束/未开始
+)
+
+// ***微信客服 start***//
+// 企业微信回调微信客服消息事件解密后的数据，收到后需调用sync_msg拉取具体消息
+type ReqMsgContentKfMsgOrEvent struct {
+	CallbackEventCommon
+	Token    string `xml:"Token"`    // 调用拉取消息接口时需要传此token，10分钟内有效
+	OpenKfID string `xml:"OpenKfId"` // 有新消息的客服账号
+}
+
+// 客服账号
+type KfAccount struct {
+	OpenKfID        string `json:"open_kfid,omitempty"`        // 客服账号id
+	Name            string `json:"name,omitempty"`             // 客服名称，不多于16个字符
+	Avatar          string `json:"avatar,omitempty"`           // 客服头像url
+	MediaID         string `json:"media_id,omitempty"`         // 客服头像临时素材，添加和修改时使用
+	ManagePrivilege bool   `json:"manage_privilege,omitempty"` // 当前调用接口的应用是否有该客服账号的管理权限
+}
+
+// 添加客服账号响应字段
+type AddKfAccountResp struct {
+	CommonResp
+	OpenKfID string `json:"open_kfid"` // 新创建的客服账号id
+}
+
+// 获取客服账号列表请求字段
+type ListKfAccountReq struct {
+	Offset int `json:"offset"` // 分页偏移量
+	Limit  int `json:"limit"`  // 分页条数，最大100
+}
+
+// 获取客服账号列表响应字段
+type ListKfAccountResp struct {
+	CommonResp
+	AccountList []KfAccount `json:"account_list"` // 客服账号列表
+}
+
+// 获取客服账号链接请求字段
+type KfContactWayReq struct {
+	OpenKfID string `json:"open_kfid"`       // 客服账号id
+	Scene    string `json:"scene,omitempty"` // 场景值，用于区分客户从哪里进入，在enter_session事件中原样返回
+}
+
+// 获取客服账号链接响应字段
+type KfContactWayResp struct {
+	CommonResp
+	URL string `json:"url"` // 客服链接，可直接生成二维码或在微信中打开
+}
+
+// 接待人员请求字段
+type KfServicerReq struct {
+	OpenKfID   string   `json:"open_kfid"`   // 客服账号id
+	UserIDList []string `json:"userid_list"` // 接待人员userid列表，最多100个
+}
+
+// 接待人员
+type KfServicer struct {
+	UserID string `json:"userid"` // 接待人员的userid
+	Status int    `json:"status"` // 接待状态：0-接待中，1-停止接待
+}
+
+// 接待人员操作结果
+type KfServicerResult struct {
+	CommonResp
+	UserID string `json:"userid"` // 接待人员的userid
+}
+
+// 添加或删除接待人员响应字段
+type KfServicerResp struct {
+	CommonResp
+	ResultList []KfServicerResult `json:"result_list"` // 每个接待人员的操作结果
+}
+
+// 获取接待人员列表响应字段
+type ListKfServicerResp struct {
+	CommonResp
+	ServicerList []KfServicer `json:"servicer_list"` // 接待人员列表
+}
+
+// 拉取消息请求字段
+type KfSyncMsgReq struct {
+	Cursor      string `json:"cursor,omitempty"`       // 上一次调用时返回的next_cursor
+	Token       string `json:"token,omitempty"`        // 回调事件中的token，不填时有频率限制
+	Limit       int    `json:"limit,omitempty"`        // 期望请求的数据量，默认1000
+	VoiceFormat int    `json:"voice_format,omitempty"` // 语音消息类型：0-amr，1-silk
+	OpenKfID    string `json:"open_kfid"`              // 客服账号id
+}
+
+// 拉取消息响应字段
+type KfSyncMsgResp struct {
+	CommonResp
+	NextCursor string  `json:"next_cursor"` // 下次调用带上该值则从该key值往后拉
+	HasMore    int     `json:"has_more"`    // 是否还有更多数据：0-否，1-是
+	MsgList    []KfMsg `json:"msg_list"`    // 消息列表
+}
+
+// 微信客服消息
+type KfMsg struct {
+	MsgID          string          `json:"msgid"`           // 消息id
+	OpenKfID       string          `json:"open_kfid"`       // 客服账号id
+	ExternalUserID string          `json:"external_userid"` // 客户userid
+	SendTime       int64           `json:"send_time"`       // 消息发送时间
+	Origin         int             `json:"origin"`          // 消息来源：3-微信客户发送，4-系统推送的事件，5-接待人员在企业微信客户端发送
+	ServicerUserID string          `json:"servicer_userid"` // 接待人员的userid，origin为5时有
+	MsgType        string          `json:"msgtype"`         // 消息类型
+	Text           *KfText         `json:"text"`            // 文本消息
+	Image          *Media          `json:"image"`           // 图片消息
+	Voice          *Media          `json:"voice"`           // 语音消息
+	Video          *Media          `json:"video"`           // 视频消息
+	File           *Media          `json:"file"`            // 文件消息
+	Location       *KfLocation     `json:"location"`        // 位置消息
+	Link           *KfLink         `json:"link"`            // 链接消息
+	BusinessCard   *KfBusinessCard `json:"business_card"`   // 名片消息
+	MiniProgram    *KfMiniProgram  `json:"miniprogram"`     // 小程序消息
+	MsgMenu        *KfMsgMenu      `json:"msgmenu"`         // 菜单消息
+	Event          *KfEvent        `json:"event"`           // 事件消息
+}
+
+// 客服文本消息
+type KfText struct {
+	Content string `json:"content"`           // 文本内容
+	MenuID  string `json:"menu_id,omitempty"` // 客户点击菜单消息时对应的菜单id
+}
+
+// 客服位置消息
+type KfLocation struct {
+	Latitude  float64 `json:"latitude"`  // 纬度
+	Longitude float64 `json:"longitude"` // 经度
+	Name      string  `json:"name"`      // 位置名
+	Address   string  `json:"address"`   // 地址详情说明
+}
+
+// 客服链接消息
+type KfLink struct {
+	Title        string `json:"title"`                    // 标题
+	Desc         string `json:"desc,omitempty"`           // 描述
+	URL          string `json:"url"`                      // 点击后跳转的链接
+	PicURL       string `json:"pic_url,omitempty"`        // 缩略图链接，接收消息时有
+	ThumbMediaID string `json:"thumb_media_id,omitempty"` // 缩略图的media_id，发送消息时使用
+}
+
+// 客服名片消息
+type KfBusinessCard struct {
+	UserID string `json:"userid"` // 名片userid
+}
+
+// 客服小程序消息
+type KfMiniProgram struct {
+	AppID        string `json:"appid"`          // 小程序appid
+	Title        string `json:"title"`          // 小程序消息标题
+	ThumbMediaID string `json:"thumb_media_id"` // 小程序消息封面的media_id
+	PagePath     string `json:"pagepath"`       // 点击消息卡片后进入的小程序页面路径
+}
+
+// 客服菜单消息
+type KfMsgMenu struct {
+	HeadContent string          `json:"head_content,omitempty"` // 起始文本
+	List        []KfMsgMenuItem `json:"list"`                   // 菜单项配置，最多10个
+	TailContent string          `json:"tail_content,omitempty"` // 结束文本
+}
+
+// 客服菜单项，按type填写对应的内容
+type KfMsgMenuItem struct {
+	Type        string             `json:"type"`                  // 菜单类型：click-回复菜单，view-超链接菜单，miniprogram-小程序菜单，text-文本
+	Click       *KfMenuClick       `json:"click,omitempty"`       // 回复菜单，客户点击后回复一条文本消息并带上menu_id
+	View        *KfMenuView        `json:"view,omitempty"`        // 超链接菜单
+	MiniProgram *KfMenuMiniProgram `json:"miniprogram,omitempty"` // 小程序菜单
+	Text        *KfMenuText        `json:"text,omitempty"`        // 文本
+}
+
+// 回复菜单
+type KfMenuClick struct {
+	ID      string `json:"id,omitempty"` // 菜单id
+	Content string `json:"content"`      // 菜单显示内容
+}
+
+// 超链接菜单
+type KfMenuView struct {
+	URL     string `json:"url"`     // 点击后跳转的链接
+	Content string `json:"content"` // 菜单显示内容
+}
+
+// 小程序菜单
+type KfMenuMiniProgram struct {
+	AppID    string `json:"appid"`    // 小程序appid
+	PagePath string `json:"pagepath"` // 点击后进入的小程序页面
+	Content  string `json:"content"`  // 菜单显示内容
+}
+
+// 菜单中的文本
+type KfMenuText struct {
+	Content   string `json:"content"`              // 文本内容
+	NoNewline int    `json:"no_newline,omitempty"` // 内容后面是否不换行：0-换行，1-不换行
+}
+
+// 客服事件
+type KfEvent struct {
+	EventType         string `json:"event_type"`          // 事件类型：enter_session、msg_send_fail、servicer_status_change、session_status_change、user_recall_msg等
+	OpenKfID          string `json:"open_kfid"`           // 客服账号id
+	ExternalUserID    string `json:"external_userid"`     // 客户userid
+	Scene             string `json:"scene"`               // 进入会话的场景值，获取客服账号链接时指定
+	SceneParam        string `json:"scene_param"`         // 进入会话的自定义参数
+	WelcomeCode       string `json:"welcome_code"`        // 发送欢迎语的code，20秒内有效，仅enter_session事件有
+	FailMsgID         string `json:"fail_msgid"`          // 发送失败的消息msgid
+	FailType          int    `json:"fail_type"`           // 消息发送失败的类型
+	ServicerUserID    string `json:"servicer_userid"`     // 接待人员的userid
+	Status            int    `json:"status"`              // 接待人员的状态：1-接待中，2-停止接待
+	ChangeType        int    `json:"change_type"`         // 会话变化类型：1-从接待池接入会话，2-转接会话，3-结束会话，4-重新接入已结束/已转接会话
+	OldServicerUserID string `json:"old_servicer_userid"` // 老的接待人员userid
+	NewServicerUserID string `json:"new_servicer_userid"` // 新的接待人员userid
+	MsgCode           string `json:"msg_code"`            // 用于发送事件响应消息的code，仅结束会话和转接时有
+	RecallMsgID       string `json:"recall_msgid"`        // 客户撤回的消息msgid
+}
+
+// 发送客服消息请求字段，按msgtype填写对应的消息内容
+type KfSendMsg struct {
+	ToUser      string         `json:"touser"`                // 客户的external_userid
+	OpenKfID    string         `json:"open_kfid"`             // 客服账号id
+	MsgID       string         `json:"msgid,omitempty"`       // 指定消息id，不填时由系统生成
+	MsgType     string         `json:"msgtype"`               // 消息类型：text、image、voice、video、file、link、miniprogram、msgmenu、location
+	Text        *Text          `json:"text,omitempty"`        // 文本消息
+	Image       *Media         `json:"image,omitempty"`       // 图片消息
+	Voice       *Media         `json:"voice,omitempty"`       // 语音消息
+	Video       *Media         `json:"video,omitempty"`       // 视频消息
+	File        *Media         `json:"file,omitempty"`        // 文件消息
+	Link        *KfLink        `json:"link,omitempty"`        // 图文链接消息
+	MiniProgram *KfMiniProgram `json:"miniprogram,omitempty"` // 小程序消息
+	MsgMenu     *KfMsgMenu     `json:"msgmenu,omitempty"`     // 菜单消息
+	Location    *KfLocation    `json:"location,omitempty"`    // 位置消息
+}
+
+// 发送事件响应消息请求字段，仅支持文本和菜单消息
+type KfSendMsgOnEventReq struct {
+	Code    string     `json:"code"`              // 事件响应消息对应的code，如enter_session中的welcome_code
+	MsgID   string     `json:"msgid,omitempty"`   // 指定消息id
+	MsgType string     `json:"msgtype"`           // 消息类型：text、msgmenu
+	Text    *Text      `json:"text,omitempty"`    // 文本消息
+	MsgMenu *KfMsgMenu `json:"msgmenu,omitempty"` // 菜单消息
+}
+
+// 发送客服消息响应字段
+type KfSendMsgResp struct {
+	CommonResp
+	MsgID string `json:"msgid"` // 消息id
+}
+
+// 会话状态请求字段
+type KfServiceStateReq struct {
+	OpenKfID       string `json:"open_kfid"`                 // 客服账号id
+	ExternalUserID string `json:"external_userid"`           // 客户userid
+	ServiceState   int    `json:"service_state,omitempty"`   // 变更的目标状态，变更时填写
+	ServicerUserID string `json:"servicer_userid,omitempty"` // 接待人员的userid，目标状态为人工接待时必填
+}
+
+// 获取会话状态响应字段
+type KfServiceStateResp struct {
+	CommonResp
+	ServiceState   int    `json:"service_state"`   // 当前的会话状态
+	ServicerUserID string `json:"servicer_userid"` // 接待人员的userid，仅人工接待时有
+}
+
+// 变更会话状态响应字段
+type KfTransServiceStateResp struct {
+	CommonResp
+	MsgCode string `json:"msg_code"` // 用于发送响应事件消息的code，可用于发送结束语等
+}
+
+// ***微信客服 end***//
+
+// 微信客服消息处理函数
+type KfMsgHandler func(msg *KfMsg)
+
+var (
+	kfHandlerMu     sync.RWMutex
+	kfMsgHandlers   = map[string][]KfMsgHandler{} // msgtype到处理函数
+	kfEventHandlers = map[string][]KfMsgHandler{} // 事件类型到处理函数
+	kfSyncLocks     = NewKeyedMutex()             // 同一客服账号同一时间只有一个拉取，避免重复使用同一个游标
+	kfStartTime     = time.Now()                  // 服务启动时间，首次拉取时忽略此前的历史消息
+)
+
+func init() {
+	RegisterEventHandler("kf_msg_or_event", CallbackKfMsgOrEvent)
+}
+
+// AddKfAccount
+// @Description: 添加客服账号，mediaID为客服头像的临时素材
+func AddKfAccount(access_token string, name string, mediaID string) (openKfID string, err error) {
+	resp := new(AddKfAccountResp)
+	err = PostAPI("/cgi-bin/kf/account/add", access_token, KfAccount{Name: name, MediaID: mediaID}, resp)
+	return resp.OpenKfID, err
+}
+
+// DelKfAccount
+// @Description: 删除客服账号
+func DelKfAccount(access_token string, openKfID string) (err error) {
+	return PostAPI("/cgi-bin/kf/account/del", access_token, KfAccount{OpenKfID: openKfID}, new(CommonResp))
+}
+
+// UpdateKfAccount
+// @Description: 修改客服账号的名称或头像
+func UpdateKfAccount(access_token string, account *KfAccount) (err error) {
+	return PostAPI("/cgi-bin/kf/account/update", access_token, account, new(CommonResp))
+}
+
+// ListKfAccount
+// @Description: 获取全部客服账号
+func ListKfAccount(access_token string) (accounts []KfAccount, err error) {
+	for offset := 0; ; offset += 100 {
+		resp := new(ListKfAccountResp)
+		err = PostAPI("/cgi-bin/kf/account/list", access_token, ListKfAccountReq{Offset: offset, Limit: 100}, resp)
+		if err != nil {
+			return accounts, err
+		}
+		accounts = append(accounts, resp.AccountList...)
+		if len(resp.AccountList) < 100 {
+			return accounts, nil
+		}
+	}
+}
+
+// AddKfContactWay
+// @Description: 获取客服账号链接，scene会在客户进入会话事件中原样返回
+func AddKfContactWay(access_token string, openKfID string, scene string) (contactURL string, err error) {
+	resp := new(KfContactWayResp)
+	err = PostAPI("/cgi-bin/kf/add_contact_way", access_token, KfContactWayReq{OpenKfID: openKfID, Scene: scene}, resp)
+	return resp.URL, err
+}
+
+// AddKfServicer
+// @Description: 添加接待人员
+func AddKfServicer(access_token string, openKfID string, userids []string) (resp *KfServicerResp, err error) {
+	resp = new(KfServicerResp)
+	err = PostAPI("/cgi-bin/kf/servicer/add", access_token, KfServicerReq{OpenKfID: openKfID, UserIDList: userids}, resp)
+	return resp, err
+}
+
+// DelKfServicer
+// @Description: 删除接待人员
+func DelKfServicer(access_token string, openKfID string, userids []string) (resp *KfServicerResp, err error) {
+	resp = new(KfServicerResp)
+	err = PostAPI("/cgi-bin/kf/servicer/del", access_token, KfServicerReq{OpenKfID: openKfID, UserIDList: userids}, resp)
+	return resp, err
+}
+
+// ListKfServicer
+// @Description: 获取客服账号的接待人员列表
+func ListKfServicer(access_token string, openKfID string) (servicers []KfServicer, err error) {
+	resp := new(ListKfServicerResp)
+	err = GetAPI("/cgi-bin/kf/servicer/list", access_token, url.Values{"open_kfid": {openKfID}}, resp)
+	return resp.ServicerList, err
+}
+
+// SyncKfMsg
+// @Description: 拉取一页微信客服消息
+func SyncKfMsg(access_token string, req *KfSyncMsgReq) (resp *KfSyncMsgResp, err error) {
+	resp = new(KfSyncMsgResp)
+	err = PostAPI("/cgi-bin/kf/sync_msg", access_token, req, resp)
+	return resp, err
+}
+
+// SyncAllKfMsg
+// @Description: 从保存的游标开始拉取客服账号的全部新消息并交给注册的处理函数，每页处理完后保存游标，
+// 没有保存的游标时接口会返回最近3天的消息，此时只处理服务启动后发送的消息，避免重复处理已处理过的历史消息
+func SyncAllKfMsg(access_token string, openKfID string, token string) (err error) {
+	unlock := kfSyncLocks.Lock(openKfID)
+	defer unlock()
+	cursor, hasCursor := Store.Get(kfCursorKeyPrefix + openKfID)
+	for {
+		resp, err := SyncKfMsg(access_token, &KfSyncMsgReq{Cursor: cursor, Token: token, Limit: KfSyncMsgLimit, OpenKfID: openKfID})
+		if err != nil {
+			return err
+		}
+		for i := range resp.MsgList {
+			if !hasCursor && resp.MsgList[i].SendTime < kfStartTime.Unix() {
+				continue
+			}
+			dispatchKfMsg(&resp.MsgList[i])
+		}
+		if resp.NextCursor != "" {
+			cursor = resp.NextCursor
+			if err = Store.Set(kfCursorKeyPrefix+openKfID, cursor); err != nil {
+				fmt.Println("kf save cursor err: ", err)
+			}
+		}
+		if resp.HasMore == 0 {
+			return nil
+		}
+	}
+}
+
+// OnKfMsg
+// @Description: 注册微信客服消息处理函数，msgtype如text、image
+func OnKfMsg(msgType string, handler KfMsgHandler) {
+	kfHandlerMu.Lock()
+	defer kfHandlerMu.Unlock()
+	kfMsgHandlers[msgType] = append(kfMsgHandlers[msgType], handler)
+}
+
+// OnKfEvent
+// @Description: 注册微信客服事件处理函数，eventType如enter_session、session_status_change
+func OnKfEvent(eventType string, handler KfMsgHandler) {
+	kfHandlerMu.Lock()
+	defer kfHandlerMu.Unlock()
+	kfEventHandlers[eventType] = append(kfEventHandlers[eventType], handler)
+}
+
+// 按消息类型或事件类型分发客服消息
+func dispatchKfMsg(msg *KfMsg) {
+	kfHandlerMu.RLock()
+	handlers := kfMsgHandlers[msg.MsgType]
+	if msg.MsgType == "event" && msg.Event != nil {
+		handlers = kfEventHandlers[msg.Event.EventType]
+	}
+	kfHandlerMu.RUnlock()
+	for _, handler := range handlers {
+		handler(msg)
+	}
+}
+
+// SendKfMsg
+// @Description: 发送客服消息，客户主动发消息后48小时内最多可回复5条
+func SendKfMsg(access_token string, msg *KfSendMsg) (msgid string, err error) {
+	resp := new(KfSendMsgResp)
+	err = PostAPI("/cgi-bin/kf/send_msg", access_token, msg, resp)
+	return resp.MsgID, err
+}
+
+// SendKfText
+// @Description: 发送客服文本消息
+func SendKfText(access_token string, openKfID string, externalUserID string, content string) (msgid string, err error) {
+	return SendKfMsg(access_token, &KfSendMsg{ToUser: externalUserID, OpenKfID: openKfID, MsgType: "text", Text: &Text{Content: content}})
+}
+
+// SendKfImage
+// @Description: 发送客服图片消息，mediaID为临时素材
+func SendKfImage(access_token string, openKfID string, externalUserID string, mediaID string) (msgid string, err error) {
+	return SendKfMsg(access_token, &KfSendMsg{ToUser: externalUserID, OpenKfID: openKfID, MsgType: "image", Image: &Media{MediaID: mediaID}})
+}
+
+// SendKfLink
+// @Description: 发送客服图文链接消息，link中的thumb_media_id为缩略图临时素材
+func SendKfLink(access_token string, openKfID string, externalUserID string, link *KfLink) (msgid string, err error) {
+	return SendKfMsg(access_token, &KfSendMsg{ToUser: externalUserID, OpenKfID: openKfID, MsgType: "link", Link: link})
+}
+
+// SendKfMiniProgram
+// @Description: 发送客服小程序消息
+func SendKfMiniProgram(access_token string, openKfID string, externalUserID string, miniProgram *KfMiniProgram) (msgid string, err error) {
+	return SendKfMsg(access_token, &KfSendMsg{ToUser: externalUserID, OpenKfID: openKfID, MsgType: "miniprogram", MiniProgram: miniProgram})
+}
+
+// SendKfMenu
+// @Description: 发送客服菜单消息
+func SendKfMenu(access_token string, openKfID string, externalUserID string, menu *KfMsgMenu) (msgid string, err error) {
+	return SendKfMsg(access_token, &KfSendMsg{ToUser: externalUserID, OpenKfID: openKfID, MsgType: "msgmenu", MsgMenu: menu})
+}
+
+// SendKfMsgOnEvent
+// @Description: 发送事件响应消息，如进入会话的欢迎语、结束会话的结束语，code只能使用一次
+func SendKfMsgOnEvent(access_token string, req *KfSendMsgOnEventReq) (msgid string, err error) {
+	resp := new(KfSendMsgResp)
+	err = PostAPI("/cgi-bin/kf/send_msg_on_event", access_token, req, resp)
+	return resp.MsgID, err
+}
+
+// SendKfWelcomeText
+// @Description: 用enter_session事件中的welcome_code发送文本欢迎语，需在20秒内调用
+func SendKfWelcomeText(access_token string, welcomeCode string, content string) (msgid string, err error) {
+	return SendKfMsgOnEvent(access_token, &KfSendMsgOnEventReq{Code: welcomeCode, MsgType: "text", Text: &Text{Content: content}})
+}
+
+// GetKfServiceState
+// @Description: 获取客户的会话状态
+func GetKfServiceState(access_token string, openKfID string, externalUserID string) (resp *KfServiceStateResp, err error) {
+	resp = new(KfServiceStateResp)
+	err = PostAPI("/cgi-bin/kf/service_state/get", access_token, KfServiceStateReq{OpenKfID: openKfID, ExternalUserID: externalUserID}, resp)
+	return resp, err
+}
+
+// TransKfServiceState
+// @Description: 变更客户的会话状态，如转人工接待、放入接待池排队、结束会话，返回的msg_code可用于发送结束语
+func TransKfServiceState(access_token string, req *KfServiceStateReq) (msgCode string, err error) {
+	resp := new(KfTransServiceStateResp)
+	err = PostAPI("/cgi-bin/kf/service_state/trans", access_token, req, resp)
+	return resp.MsgCode, err
+}
+
+// TransKfToServicer
+// @Description: 将会话转给指定接待人员
+func TransKfToServicer(access_token string, openKfID string, externalUserID string, servicerUserID string) (msgCode string, err error) {
+	return TransKfServiceState(access_token, &KfServiceStateReq{OpenKfID: openKfID, ExternalUserID: externalUserID, ServiceState: KfServiceStateServicer, ServicerUserID: servicerUserID})
+}
+
+// TransKfToQueue
+// @Description: 将会话放入接待池排队
+func TransKfToQueue(access_token string, openKfID string, externalUserID string) (msgCode string, err error) {
+	return TransKfServiceState(access_token, &KfServiceStateReq{OpenKfID: openKfID, ExternalUserID: externalUserID, ServiceState: KfServiceStateQueue})
+}
+
+// EndKfSession
+// @Description: 结束会话
+func EndKfSession(access_token string, openKfID string, externalUserID string) (msgCode string, err error) {
+	return TransKfServiceState(access_token, &KfServiceStateReq{OpenKfID: openKfID, ExternalUserID: externalUserID, ServiceState: KfServiceStateEnded})
+}
+
+// CallbackKfMsgOrEvent
+// @Description: 处理微信客服消息事件，异步拉取新消息，回调需要在5秒内响应
+func CallbackKfMsgOrEvent(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentKfMsgOrEvent)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback kf msg unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	fmt.Println("callback kf msg or event: ", reqMsgContent.OpenKfID)
+
+	safeGo("kf sync msg", func() {
+		access_token, err := GetAppAccessToken()
+		if err != nil {
+			fmt.Println("kf sync msg get token err, open_kfid: "+reqMsgContent.OpenKfID+" err: ", err)
+			return
+		}
+		if err = SyncAllKfMsg(access_token, reqMsgContent.OpenKfID, reqMsgContent.Token); err != nil {
+			fmt.Println("kf sync msg err: ", err)
+		}
+	})
+	return http.StatusOK, nil, nil
+}
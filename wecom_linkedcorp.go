@@ -0,0 +1,217 @@
+package main
+
+import (
+	"strings"
+)
+
+// ***互联企业 start***//
+// 互联企业消息，touser格式为"CorpId/UserId"，toparty格式为"LinkedId/DepartmentId"，本企业的成员和部门可直接填id
+type LinkedCorpMsg struct {
+	ToUser  []string `json:"touser,omitempty"`  // 成员ID列表，最多支持1000个
+	ToParty []string `json:"toparty,omitempty"` // 部门ID列表，最多支持100个
+	ToTag   []string `json:"totag,omitempty"`   // 本企业的标签ID列表，最多支持100个
+	ToAll   int      `json:"toall,omitempty"`   // 1表示发送给应用可见范围内的所有人（包括互联企业的成员）
+	MsgType string   `json:"msgtype"`           // 消息类型
+	AgentID int      `json:"agentid"`           // 企业应用的id
+	MsgContent
+	Safe int `json:"safe"` // 是否是保密消息
+}
+
+// 互联企业消息发送响应字段
+type LinkedCorpMsgResp struct {
+	CommonResp
+	InvalidUser  []string `json:"invaliduser"`  // 不合法的userid
+	InvalidParty []string `json:"invalidparty"` // 不合法的partyid
+	InvalidTag   []string `json:"invalidtag"`   // 不合法的标签id
+}
+
+// 应用的可见范围响应字段
+type LinkedCorpPermListResp struct {
+	CommonResp
+	UserIDs       []string `json:"userids"`        // 可见的userid，格式为"CorpId/UserId"
+	DepartmentIDs []string `json:"department_ids"` // 可见的部门id，格式为"LinkedId/DepartmentId"
+}
+
+// 互联企业成员
+type LinkedCorpUser struct {
+	UserID     string       `json:"userid"`     // 成员UserID，格式为"CorpId/UserId"
+	Name       string       `json:"name"`       // 成员真实名称
+	Department []string     `json:"department"` // 成员所属部门，格式为"LinkedId/DepartmentId"
+	Mobile     string       `json:"mobile"`     // 手机号码
+	Telephone  string       `json:"telephone"`  // 座机
+	Email      string       `json:"email"`      // 邮箱
+	Position   string       `json:"position"`   // 职务
+	CorpID     string       `json:"corpid"`     // 所属企业的corpid
+	ExtAttr    *UserExtAttr `json:"extattr"`    // 扩展属性
+}
+
+// 获取互联企业成员响应字段
+type LinkedCorpUserResp struct {
+	CommonResp
+	UserInfo LinkedCorpUser `json:"user_info"` // 成员详情
+}
+
+// 获取互联企业部门成员响应字段
+type LinkedCorpUserListResp struct {
+	CommonResp
+	UserList []LinkedCorpUser `json:"userlist"` // 成员列表
+}
+
+// 互联企业部门
+type LinkedCorpDepartment struct {
+	DepartmentID   string `json:"department_id"`   // 部门id，格式为"LinkedId/DepartmentId"
+	DepartmentName string `json:"department_name"` // 部门名称
+	ParentID       string `json:"parentid"`        // 上级部门的id
+	Order          int    `json:"order"`           // 在父部门中的次序值
+}
+
+// 获取互联企业部门列表响应字段
+type LinkedCorpDepartmentListResp struct {
+	CommonResp
+	DepartmentList []LinkedCorpDepartment `json:"department_list"` // 部门列表
+}
+
+// 互联企业成员/部门请求字段
+type LinkedCorpReq struct {
+	UserID       string `json:"userid,omitempty"`        // 成员UserID，格式为"CorpId/UserId"
+	DepartmentID string `json:"department_id,omitempty"` // 部门id，格式为"LinkedId/DepartmentId"
+	FetchChild   bool   `json:"fetch_child,omitempty"`   // 是否递归获取子部门下面的成员
+}
+
+// ***互联企业 end***//
+
+// LinkedCorpUserID
+// @Description: 拼接互联企业成员id
+func LinkedCorpUserID(corpid string, userid string) string {
+	return corpid + "/" + userid
+}
+
+// LinkedCorpDepartmentID
+// @Description: 拼接互联企业部门id
+func LinkedCorpDepartmentID(linkedid string, departmentID string) string {
+	return linkedid + "/" + departmentID
+}
+
+// SendLinkedCorpMsg
+// @Description: 发送消息到互联企业的成员或部门，msgtype未设置时按填写的消息内容推断
+func SendLinkedCorpMsg(access_token string, msg *LinkedCorpMsg) (resp *LinkedCorpMsgResp, err error) {
+	if msg.MsgType == "" {
+		msg.MsgType = msg.MsgContent.InferMsgType()
+	}
+	if msg.AgentID == 0 {
+		msg.AgentID = AgentID
+	}
+	resp = new(LinkedCorpMsgResp)
+	err = PostAPI("/cgi-bin/linkedcorp/message/send", access_token, msg, resp)
+	return resp, err
+}
+
+// SendLinkedCorpText
+// @Description: 发送文本消息到互联企业成员，超长内容按opt拆分或截断后依次发送
+func SendLinkedCorpText(access_token string, touser []string, content string, opt ContentOption) (err error) {
+	parts, err := FitContent(content, TextContentMaxBytes, opt)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		_, err = SendLinkedCorpMsg(access_token, &LinkedCorpMsg{ToUser: touser, MsgType: "text", MsgContent: MsgContent{Text: &Text{Content: part}}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetLinkedCorpPermList
+// @Description: 获取应用在互联企业中的可见范围
+func GetLinkedCorpPermList(access_token string) (resp *LinkedCorpPermListResp, err error) {
+	resp = new(LinkedCorpPermListResp)
+	err = PostAPI("/cgi-bin/linkedcorp/agent/get_perm_list", access_token, struct{}{}, resp)
+	return resp, err
+}
+
+// GetLinkedCorpUser
+// @Description: 获取互联企业成员详情，userid格式为"CorpId/UserId"
+func GetLinkedCorpUser(access_token string, userid string) (user *LinkedCorpUser, err error) {
+	resp := new(LinkedCorpUserResp)
+	err = PostAPI("/cgi-bin/linkedcorp/user/get", access_token, LinkedCorpReq{UserID: userid}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.UserInfo, nil
+}
+
+// ListLinkedCorpSimpleUser
+// @Description: 获取互联企业部门成员（userid、name、department）
+func ListLinkedCorpSimpleUser(access_token string, departmentID string, fetchChild bool) (users []LinkedCorpUser, err error) {
+	resp := new(LinkedCorpUserListResp)
+	err = PostAPI("/cgi-bin/linkedcorp/user/simplelist", access_token, LinkedCorpReq{DepartmentID: departmentID, FetchChild: fetchChild}, resp)
+	return resp.UserList, err
+}
+
+// ListLinkedCorpUser
+// @Description: 获取互联企业部门成员详情
+func ListLinkedCorpUser(access_token string, departmentID string, fetchChild bool) (users []LinkedCorpUser, err error) {
+	resp := new(LinkedCorpUserListResp)
+	err = PostAPI("/cgi-bin/linkedcorp/user/list", access_token, LinkedCorpReq{DepartmentID: departmentID, FetchChild: fetchChild}, resp)
+	return resp.UserList, err
+}
+
+// ListLinkedCorpDepartment
+// @Description: 获取互联企业部门及其子部门列表
+func ListLinkedCorpDepartment(access_token string, departmentID string) (departments []LinkedCorpDepartment, err error) {
+	resp := new(LinkedCorpDepartmentListResp)
+	err = PostAPI("/cgi-bin/linkedcorp/department/list", access_token, LinkedCorpReq{DepartmentID: departmentID}, resp)
+	return resp.DepartmentList, err
+}
+
+// ListLinkedCorpVisibleUser
+// @Description: 获取应用可见范围内的全部互联企业成员，包括可见部门下的成员，按userid去重
+func ListLinkedCorpVisibleUser(access_token string) (users []LinkedCorpUser, err error) {
+	perm, err := GetLinkedCorpPermList(access_token)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	for _, userid := range perm.UserIDs {
+		user, err := GetLinkedCorpUser(access_token, userid)
+		if err != nil {
+			return users, err
+		}
+		seen[user.UserID] = true
+		users = append(users, *user)
+	}
+	for _, departmentID := range perm.DepartmentIDs {
+		departmentUsers, err := ListLinkedCorpUser(access_token, departmentID, true)
+		if err != nil {
+			return users, err
+		}
+		for _, user := range departmentUsers {
+			if !seen[user.UserID] {
+				seen[user.UserID] = true
+				users = append(users, user)
+			}
+		}
+	}
+	return users, nil
+}
+
+// FindLinkedCorpUsers
+// @Description: 在应用可见范围内按姓名、手机号或邮箱查找互联企业成员，返回可直接用于发送的userid
+func FindLinkedCorpUsers(access_token string, keyword string) (userids []string, err error) {
+	users, err := ListLinkedCorpVisibleUser(access_token)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		if user.Name == keyword || user.Mobile == keyword || strings.EqualFold(user.Email, keyword) {
+			userid := user.UserID
+			// 部分接口返回的userid不带corpid前缀
+			if !strings.Contains(userid, "/") && user.CorpID != "" {
+				userid = LinkedCorpUserID(user.CorpID, userid)
+			}
+			userids = append(userids, userid)
+		}
+	}
+	return userids, nil
+}
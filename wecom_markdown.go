@@ -0,0 +1,277 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 企业微信markdown仅支持标题、加粗、链接、行内代码、引用和字体颜色(info/comment/warning)，
+// 其余CommonMark语法会被原样显示或错误渲染，这里按行转换并对不支持的语法做降级处理
+
+var (
+	mdFenceRe             = regexp.MustCompile("^\\s{0,3}(```+|~~~+)")
+	mdATXHeaderRe         = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)(\s+#+)?\s*$`)
+	mdSetextRe            = regexp.MustCompile(`^\s{0,3}(=+|-+)\s*$`)
+	mdThematicRe          = regexp.MustCompile(`^\s{0,3}((\*\s*){3,}|(-\s*){3,}|(_\s*){3,})$`)
+	mdQuoteRe             = regexp.MustCompile(`^\s{0,3}(>\s?)+`)
+	mdBulletRe            = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	mdOrderedRe           = regexp.MustCompile(`^(\s*)(\d{1,9})[.)]\s+(.*)$`)
+	mdTaskRe              = regexp.MustCompile(`^\[([ xX])\]\s+`)
+	mdTableDelimRe        = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?\s*$`)
+	mdLinkDefRe           = regexp.MustCompile(`^\s{0,3}\[([^\]]+)\]:\s*<?(\S+?)>?(\s+.*)?$`)
+	mdImageRe             = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)(\s+"[^"]*")?\)`)
+	mdLinkTitleRe         = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\s+"[^"]*"\)`)
+	mdRefLinkRe           = regexp.MustCompile(`\[([^\]]+)\]\[([^\]]*)\]`)
+	mdAutoLinkRe          = regexp.MustCompile(`<((https?|ftp)://[^>\s]+)>`)
+	mdUnderBoldRe         = regexp.MustCompile(`__([^_]+?)__`)
+	mdStarItalicRe        = regexp.MustCompile(`(^|[^*])\*([^*\s][^*]*?)\*([^*]|$)`)
+	mdUnderItalicRe       = regexp.MustCompile(`(^|\W)_([^_\s](?:[^_]*?[^_\s])?)_(\W|$)`)
+	mdLinkTargetRe        = regexp.MustCompile(`\]\(([^)\s]+)\)`)
+	mdBareURLRe           = regexp.MustCompile("(https?|ftp)://[^\\s<>()\\[\\]`\x00\x01]+")
+	mdStrikeRe            = regexp.MustCompile(`~~(.+?)~~`)
+	mdHTMLTagRe           = regexp.MustCompile(`</?([a-zA-Z][a-zA-Z0-9]*)(\s[^<>]*)?/?>`)
+	mdFontTagRe           = regexp.MustCompile(`^<font\s+color="(info|comment|warning)"\s*>$`)
+	mdEscapeRe            = regexp.MustCompile("\\\\([!\"#$%&'()*+,\\-./:;<=>?@\\[\\\\\\]^_`{|}~])")
+	mdEscapePlaceholderRe = regexp.MustCompile("\x00[0-9]+\x01")
+	mdHardBreakRe         = regexp.MustCompile(`(\s{2,}|\\)$`)
+	mdInlineCodeRe        = regexp.MustCompile("`+[^`]*`+")
+	mdListIndentUnit      = "　" // 列表缩进使用全角空格，避免被企业微信吞掉
+)
+
+// ConvertCommonMark
+// @Description: 将标准CommonMark转换为企业微信支持的markdown
+func ConvertCommonMark(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	// 收集并移除引用式链接定义
+	linkDefs := map[string]string{}
+	kept := lines[:0]
+	inFence := false
+	for _, line := range lines {
+		if mdFenceRe.MatchString(line) {
+			inFence = !inFence
+		}
+		if !inFence {
+			if m := mdLinkDefRe.FindStringSubmatch(line); m != nil {
+				linkDefs[strings.ToLower(m[1])] = m[2]
+				continue
+			}
+		}
+		kept = append(kept, line)
+	}
+	lines = kept
+
+	var out []string
+	fence := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// 代码块：降级为引用+行内代码
+		if m := mdFenceRe.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1][:1]
+				continue
+			}
+			if strings.HasPrefix(m[1], fence) {
+				fence = ""
+				continue
+			}
+		}
+		if fence != "" {
+			out = append(out, convertCodeLine(line))
+			continue
+		}
+
+		// 表格：表头下一行为分隔行时，按行降级为"列名: 值"
+		if strings.Contains(line, "|") && i+1 < len(lines) && mdTableDelimRe.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "|") {
+			header := splitTableRow(line)
+			i += 2
+			for ; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				out = append(out, convertTableRow(header, splitTableRow(lines[i]), linkDefs))
+			}
+			i--
+			continue
+		}
+
+		// setext标题：普通段落行的下一行为===或---
+		if isParagraphLine(line) && i+1 < len(lines) && mdSetextRe.MatchString(lines[i+1]) {
+			level := "# "
+			if strings.Contains(lines[i+1], "-") {
+				level = "## "
+			}
+			out = append(out, level+convertInline(strings.TrimSpace(line), linkDefs))
+			i++
+			continue
+		}
+
+		out = append(out, convertBlockLine(line, linkDefs))
+	}
+
+	return strings.TrimRight(strings.Join(out, "\n"), "\n")
+}
+
+// 是否为普通段落行，标题、列表、引用和分隔线下面的---不是setext标题
+func isParagraphLine(line string) bool {
+	return strings.TrimSpace(line) != "" && !mdATXHeaderRe.MatchString(line) && !mdThematicRe.MatchString(line) &&
+		!mdBulletRe.MatchString(line) && !mdOrderedRe.MatchString(line) && !mdQuoteRe.MatchString(line)
+}
+
+// 转换单行块级元素
+func convertBlockLine(line string, linkDefs map[string]string) string {
+	if strings.TrimSpace(line) == "" {
+		return ""
+	}
+	if mdThematicRe.MatchString(line) {
+		return "────────"
+	}
+	if m := mdATXHeaderRe.FindStringSubmatch(line); m != nil {
+		return m[1] + " " + convertInline(m[2], linkDefs)
+	}
+	// 企业微信不支持嵌套引用，统一成一级
+	if m := mdQuoteRe.FindString(line); m != "" {
+		return "> " + convertBlockLine(line[len(m):], linkDefs)
+	}
+	if m := mdBulletRe.FindStringSubmatch(line); m != nil {
+		item := m[2]
+		marker := "• "
+		if t := mdTaskRe.FindStringSubmatch(item); t != nil {
+			marker = "☐ "
+			if t[1] != " " {
+				marker = "☑ "
+			}
+			item = item[len(t[0]):]
+		}
+		return listIndent(m[1]) + marker + convertInline(item, linkDefs)
+	}
+	if m := mdOrderedRe.FindStringSubmatch(line); m != nil {
+		return listIndent(m[1]) + m[2] + ". " + convertInline(m[3], linkDefs)
+	}
+	line = mdHardBreakRe.ReplaceAllString(strings.TrimLeft(line, " \t"), "")
+	return convertInline(line, linkDefs)
+}
+
+// 列表嵌套层级按每2个空格一级计算
+func listIndent(space string) string {
+	width := len(strings.ReplaceAll(space, "\t", "    "))
+	return strings.Repeat(mdListIndentUnit, width/2)
+}
+
+// 代码块中的行转为引用内的行内代码，保留缩进
+func convertCodeLine(line string) string {
+	if strings.TrimSpace(line) == "" {
+		return ">"
+	}
+	trimmed := strings.TrimLeft(line, " \t")
+	indent := strings.Repeat(" ", len(strings.ReplaceAll(line[:len(line)-len(trimmed)], "\t", "    ")))
+	if strings.Contains(trimmed, "`") {
+		return "> " + indent + trimmed
+	}
+	return "> " + indent + "`" + trimmed + "`"
+}
+
+func splitTableRow(row string) (cells []string) {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	for _, cell := range strings.Split(row, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// 表格行降级为"• 列名: 值；列名: 值"
+func convertTableRow(header, cells []string, linkDefs map[string]string) string {
+	var pairs []string
+	for i, cell := range cells {
+		if cell == "" {
+			continue
+		}
+		cell = convertInline(cell, linkDefs)
+		if i < len(header) && header[i] != "" {
+			pairs = append(pairs, convertInline(header[i], linkDefs)+": "+cell)
+		} else {
+			pairs = append(pairs, cell)
+		}
+	}
+	return "• " + strings.Join(pairs, "；")
+}
+
+// 转换行内元素，行内代码中的内容保持不变
+func convertInline(text string, linkDefs map[string]string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range mdInlineCodeRe.FindAllStringIndex(text, -1) {
+		b.WriteString(convertInlineText(text[last:loc[0]], linkDefs))
+		// 企业微信只识别单个反引号的行内代码
+		b.WriteString("`" + strings.TrimSpace(strings.Trim(text[loc[0]:loc[1]], "`")) + "`")
+		last = loc[1]
+	}
+	b.WriteString(convertInlineText(text[last:], linkDefs))
+	return b.String()
+}
+
+func convertInlineText(text string, linkDefs map[string]string) string {
+	// 先取出转义字符，避免被当成强调等语法处理
+	var escaped []string
+	text = mdEscapeRe.ReplaceAllStringFunc(text, func(s string) string {
+		escaped = append(escaped, s[1:])
+		return "\x00" + strconv.Itoa(len(escaped)-1) + "\x01"
+	})
+	text = mdImageRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdImageRe.FindStringSubmatch(s)
+		alt := m[1]
+		if alt == "" {
+			alt = "图片"
+		}
+		return "[" + alt + "](" + m[2] + ")"
+	})
+	text = mdLinkTitleRe.ReplaceAllString(text, "[$1]($2)")
+	text = mdRefLinkRe.ReplaceAllStringFunc(text, func(s string) string {
+		m := mdRefLinkRe.FindStringSubmatch(s)
+		ref := m[2]
+		if ref == "" {
+			ref = m[1]
+		}
+		if url, ok := linkDefs[strings.ToLower(ref)]; ok {
+			return "[" + m[1] + "](" + url + ")"
+		}
+		return m[1]
+	})
+	text = mdAutoLinkRe.ReplaceAllString(text, "[$1]($1)")
+	// 链接地址和裸url同样取出，避免地址中的_、*被当成强调删掉
+	text = mdLinkTargetRe.ReplaceAllStringFunc(text, func(s string) string {
+		escaped = append(escaped, s[2:len(s)-1])
+		return "](\x00" + strconv.Itoa(len(escaped)-1) + "\x01)"
+	})
+	text = mdBareURLRe.ReplaceAllStringFunc(text, func(s string) string {
+		escaped = append(escaped, s)
+		return "\x00" + strconv.Itoa(len(escaped)-1) + "\x01"
+	})
+	text = mdHTMLTagRe.ReplaceAllStringFunc(text, func(tag string) string {
+		if mdFontTagRe.MatchString(tag) || tag == "</font>" {
+			return tag
+		}
+		return ""
+	})
+	text = mdUnderBoldRe.ReplaceAllString(text, "**$1**")
+	text = mdStrikeRe.ReplaceAllString(text, "$1")
+	text = replaceAllRepeat(mdStarItalicRe, text, "$1$2$3")
+	text = replaceAllRepeat(mdUnderItalicRe, text, "$1$2$3")
+	text = mdEscapePlaceholderRe.ReplaceAllStringFunc(text, func(s string) string {
+		i, _ := strconv.Atoi(s[1 : len(s)-1])
+		return escaped[i]
+	})
+	return text
+}
+
+// 重复替换直到没有匹配，正则的边界字符会被匹配消耗，相邻的两处（如"*a* *b*"）一次只能替换第一处
+func replaceAllRepeat(re *regexp.Regexp, text string, repl string) string {
+	for {
+		replaced := re.ReplaceAllString(text, repl)
+		if replaced == text {
+			return text
+		}
+		text = replaced
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MediaMinBytes        = 5                  // 素材最小字节数
+	UploadImageMaxBytes  = 2 * 1024 * 1024    // 上传图片最大字节数
+	MediaExpire          = 3 * 24 * time.Hour // 临时素材有效期
+	MediaExpireAhead     = time.Hour          // 缓存的media_id剩余有效期不足时重新上传
+	mediaCacheKeyPrefix  = "media:"           // 素材缓存在存储中的key前缀
+	mediaErrBodyMaxBytes = 4096               // 下载素材时按错误信息解析的最大响应长度
+)
+
+// 各类临时素材的大小上限和支持的文件格式，文件格式为空表示不限制
+type mediaLimit struct {
+	maxBytes int64
+	exts     []string
+}
+
+var mediaLimits = map[string]mediaLimit{
+	"image": {10 * 1024 * 1024, []string{".jpg", ".jpeg", ".png"}},
+	"voice": {2 * 1024 * 1024, []string{".amr"}},
+	"video": {10 * 1024 * 1024, []string{".mp4"}},
+	"file":  {20 * 1024 * 1024, nil},
+}
+
+// 上传临时素材响应字段
+type UploadMediaResp struct {
+	CommonResp
+	Type      string `json:"type"`       // 媒体文件类型，分别有图片（image）、语音（voice）、视频（video），普通文件(file)
+	MediaID   string `json:"media_id"`   // 媒体文件上传后获取的唯一标识，3天内有效
+	CreatedAt string `json:"created_at"` // 媒体文件上传时间戳
+}
+
+// 上传图片响应字段
+type UploadImageResp struct {
+	CommonResp
+	URL string `json:"url"` // 图片url，永久有效
+}
+
+// 下载的素材，Body由调用方关闭
+type MediaFile struct {
+	FileName      string        // 文件名
+	ContentType   string        // 文件类型
+	ContentLength int64         // 本次返回的字节数
+	ContentRange  string        // 按范围下载时返回的范围，如"bytes 0-1023/4096"
+	Body          io.ReadCloser // 文件内容
+}
+
+// 素材缓存记录
+type mediaCacheRecord struct {
+	MediaID  string `json:"media_id"`  // 素材id
+	ExpireAt int64  `json:"expire_at"` // 过期时间戳
+}
+
+// ValidateMedia
+// @Description: 按素材类型检查文件大小和格式
+func ValidateMedia(mediaType string, fileName string, size int64) (err error) {
+	limit, ok := mediaLimits[mediaType]
+	if !ok {
+		return errors.New("unsupported media type: " + mediaType)
+	}
+	if size < MediaMinBytes || size > limit.maxBytes {
+		return errors.New(mediaType + " size out of range: " + strconv.FormatInt(size, 10))
+	}
+	if len(limit.exts) > 0 && !hasExt(fileName, limit.exts) {
+		return errors.New(mediaType + " format not supported: " + fileName)
+	}
+	return nil
+}
+
+func hasExt(fileName string, exts []string) bool {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, e := range exts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadMedia
+// @Description: 上传临时素材，mediaType为image、voice、video、file，size为文件字节数
+func UploadMedia(access_token string, mediaType string, fileName string, file io.Reader, size int64) (resp *UploadMediaResp, err error) {
+	if err = ValidateMedia(mediaType, fileName, size); err != nil {
+		return nil, err
+	}
+	fmt.Println("upload media to wecom...")
+	path := "/cgi-bin/media/upload"
+	content, err := HttpPostMultipart(apiURL(path, access_token, url.Values{"type": {mediaType}}), "media", fileName, file, size)
+	if err != nil {
+		err = redactURLErr(err)
+		fmt.Println("upload media to wecom err: ", err)
+		return nil, err
+	}
+	resp = new(UploadMediaResp)
+	err = parseAPIResp(path, content, resp)
+	return resp, err
+}
+
+// UploadMediaBytes
+// @Description: 上传内存中的临时素材
+func UploadMediaBytes(access_token string, mediaType string, fileName string, data []byte) (resp *UploadMediaResp, err error) {
+	return UploadMedia(access_token, mediaType, fileName, bytes.NewReader(data), int64(len(data)))
+}
+
+// UploadMediaCached
+// @Description: 上传内存中的临时素材，相同内容在media_id有效期内直接复用缓存
+func UploadMediaCached(access_token string, mediaType string, fileName string, data []byte) (mediaID string, err error) {
+	sum := sha256.Sum256(data)
+	key := mediaCacheKeyPrefix + mediaType + ":" + hex.EncodeToString(sum[:])
+	record := new(mediaCacheRecord)
+	ok, err := StoreGetJSON(key, record)
+	if err != nil {
+		fmt.Println("media cache get err: ", err)
+	}
+	if ok && time.Until(time.Unix(record.ExpireAt, 0)) > MediaExpireAhead {
+		return record.MediaID, nil
+	}
+
+	resp, err := UploadMediaBytes(access_token, mediaType, fileName, data)
+	if err != nil {
+		return "", err
+	}
+	expireAt := time.Now().Add(MediaExpire)
+	if createdAt, err := strconv.ParseInt(resp.CreatedAt, 10, 64); err == nil {
+		expireAt = time.Unix(createdAt, 0).Add(MediaExpire)
+	}
+	if err = StoreSetJSON(key, mediaCacheRecord{MediaID: resp.MediaID, ExpireAt: expireAt.Unix()}); err != nil {
+		fmt.Println("media cache set err: ", err)
+	}
+	return resp.MediaID, nil
+}
+
+// PurgeMediaCache
+// @Description: 删除已过期的素材缓存记录
+func PurgeMediaCache() {
+	for _, key := range Store.Keys(mediaCacheKeyPrefix) {
+		record := new(mediaCacheRecord)
+		ok, err := StoreGetJSON(key, record)
+		if err != nil || (ok && time.Now().Unix() >= record.ExpireAt) {
+			Store.Delete(key)
+		}
+	}
+}
+
+// UploadImage
+// @Description: 上传图片得到永久图片url，可用于图文消息和客户群发，仅支持jpg、png，最大2M
+func UploadImage(access_token string, fileName string, file io.Reader, size int64) (imageURL string, err error) {
+	if size < MediaMinBytes || size > UploadImageMaxBytes {
+		return "", errors.New("image size out of range: " + strconv.FormatInt(size, 10))
+	}
+	if !hasExt(fileName, mediaLimits["image"].exts) {
+		return "", errors.New("image format not supported: " + fileName)
+	}
+	fmt.Println("upload image to wecom...")
+	path := "/cgi-bin/media/uploadimg"
+	content, err := HttpPostMultipart(apiURL(path, access_token, nil), "media", fileName, file, size)
+	if err != nil {
+		err = redactURLErr(err)
+		fmt.Println("upload image to wecom err: ", err)
+		return "", err
+	}
+	resp := new(UploadImageResp)
+	err = parseAPIResp(path, content, resp)
+	return resp.URL, err
+}
+
+// DownloadMedia
+// @Description: 下载临时素材，start小于0时下载整个文件，end小于0时下载到文件末尾
+func DownloadMedia(access_token string, mediaID string, start int64, end int64) (file *MediaFile, err error) {
+	return downloadMedia("/cgi-bin/media/get", access_token, mediaID, start, end)
+}
+
+// DownloadJSSDKVoice
+// @Description: 下载JSSDK上传的高清语音素材，格式为speex，16K采样率
+func DownloadJSSDKVoice(access_token string, mediaID string) (file *MediaFile, err error) {
+	return downloadMedia("/cgi-bin/media/get/jssdk", access_token, mediaID, -1, -1)
+}
+
+// DownloadMediaTo
+// @Description: 下载整个临时素材并写入w，返回文件名和写入的字节数
+func DownloadMediaTo(access_token string, mediaID string, w io.Writer) (fileName string, n int64, err error) {
+	file, err := DownloadMedia(access_token, mediaID, -1, -1)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Body.Close()
+	n, err = io.Copy(w, file.Body)
+	return file.FileName, n, err
+}
+
+func downloadMedia(path string, access_token string, mediaID string, start int64, end int64) (file *MediaFile, err error) {
+	fmt.Println("download media from wecom...")
+	r, err := HttpGetRange(apiURL(path, access_token, url.Values{"media_id": {mediaID}}), start, end)
+	if err != nil {
+		err = redactURLErr(err)
+		fmt.Println("download media from wecom err: ", err)
+		return nil, err
+	}
+	contentType := r.Header.Get("Content-Type")
+	body := r.Body
+	// 出错时返回json错误信息而不是文件，但.json、.txt素材本身也是这些类型，只有能解析出非0错误码时才当作错误
+	if strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/plain") {
+		head, err := ioutil.ReadAll(io.LimitReader(r.Body, mediaErrBodyMaxBytes+1))
+		if err != nil {
+			r.Body.Close()
+			return nil, err
+		}
+		errResp := new(CommonResp)
+		if len(head) <= mediaErrBodyMaxBytes && json.Unmarshal(head, errResp) == nil && errResp.ErrCode != 0 {
+			r.Body.Close()
+			return nil, parseAPIResp(path, head, errResp)
+		}
+		body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	}
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusPartialContent {
+		r.Body.Close()
+		return nil, errors.New("download media http status: " + r.Status)
+	}
+
+	file = &MediaFile{
+		ContentType:   contentType,
+		ContentLength: r.ContentLength,
+		ContentRange:  r.Header.Get("Content-Range"),
+		Body:          body,
+	}
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+		file.FileName = params["filename"]
+	}
+	return file, nil
+}
+
+// ***异步上传 start***//
+// 异步上传临时素材请求字段，企业微信从url下载文件，目前仅支持客户联系入群欢迎语素材场景，不能作为通用的大文件上传
+type UploadByURLReq struct {
+	Scene    int    `json:"scene"`    // 场景值：1-客户联系入群欢迎语素材
+	Type     string `json:"type"`     // 媒体文件类型：video、file
+	FileName string `json:"filename"` // 文件名，需带后缀
+	URL      string `json:"url"`      // 文件cdn url，需要支持range分块下载
+	MD5      string `json:"md5"`      // 文件md5
+}
+
+// 异步上传临时素材响应字段
+type UploadByURLResp struct {
+	CommonResp
+	JobID string `json:"jobid"` // 任务id
+}
+
+// 查询异步上传任务结果请求字段
+type UploadByURLResultReq struct {
+	JobID string `json:"jobid"` // 任务id
+}
+
+// 异步上传任务结果
+type UploadByURLDetail struct {
+	ErrCode   int    `json:"errcode"`    // 任务失败返回码，status为3时有效
+	ErrMsg    string `json:"errmsg"`     // 任务失败错误码描述
+	MediaID   string `json:"media_id"`   // 媒体文件上传后获取的唯一标识，3天内有效
+	CreatedAt string `json:"created_at"` // 媒体文件创建的时间戳
+}
+
+// 查询异步上传任务结果响应字段
+type UploadByURLResultResp struct {
+	CommonResp
+	Status int               `json:"status"` // 任务状态：1-处理中，2-完成，3-异常失败
+	Detail UploadByURLDetail `json:"detail"` // 任务结果
+}
+
+// ***异步上传 end***//
+
+const (
+	UploadByURLMaxBytes         = 200 * 1024 * 1024 // 异步上传文件最大字节数
+	UploadByURLStatusProcessing = 1                 // 异步上传任务处理中
+	UploadByURLStatusFinished   = 2                 // 异步上传任务完成
+	UploadByURLStatusFailed     = 3                 // 异步上传任务失败
+)
+
+// 上传进度回调，sent为已发送的字节数，total为文件总字节数
+type UploadProgress func(sent int64, total int64)
+
+// 读取时报告进度的Reader
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress UploadProgress
+}
+
+func (p *progressReader) Read(b []byte) (n int, err error) {
+	n, err = p.r.Read(b)
+	if n > 0 {
+		p.sent += int64(n)
+		p.progress(p.sent, p.total)
+	}
+	return n, err
+}
+
+// UploadMediaStream
+// @Description: 边读边上传临时素材并通过progress报告进度，size小于0时先写入临时文件得到文件大小，整个文件不会读入内存
+func UploadMediaStream(access_token string, mediaType string, fileName string, file io.Reader, size int64, progress UploadProgress) (resp *UploadMediaResp, err error) {
+	if size < 0 {
+		tmp, err := ioutil.TempFile("", "wecom-media-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		// 超过上限的文件只多写1字节，由ValidateMedia报错
+		limit, ok := mediaLimits[mediaType]
+		if !ok {
+			return nil, errors.New("unsupported media type: " + mediaType)
+		}
+		if size, err = io.Copy(tmp, io.LimitReader(file, limit.maxBytes+1)); err != nil {
+			return nil, err
+		}
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		file = tmp
+	}
+	if progress != nil {
+		file = &progressReader{r: file, total: size, progress: progress}
+	}
+	return UploadMedia(access_token, mediaType, fileName, file, size)
+}
+
+// UploadMediaFile
+// @Description: 流式上传本地文件作为临时素材
+func UploadMediaFile(access_token string, mediaType string, filePath string, progress UploadProgress) (resp *UploadMediaResp, err error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return UploadMediaStream(access_token, mediaType, filepath.Base(filePath), file, info.Size(), progress)
+}
+
+// UploadMediaByURL
+// @Description: 创建异步上传临时素材任务，返回任务id，文件最大200M，仅用于入群欢迎语素材(scene=1)，其他场景请使用UploadMedia
+func UploadMediaByURL(access_token string, req *UploadByURLReq) (jobid string, err error) {
+	if req.Type != "video" && req.Type != "file" {
+		return "", errors.New("upload by url media type not supported: " + req.Type)
+	}
+	if req.Scene == 0 {
+		req.Scene = 1
+	}
+	resp := new(UploadByURLResp)
+	err = PostAPI("/cgi-bin/media/upload_by_url", access_token, req, resp)
+	return resp.JobID, err
+}
+
+// GetUploadByURLResult
+// @Description: 查询异步上传临时素材任务结果
+func GetUploadByURLResult(access_token string, jobid string) (resp *UploadByURLResultResp, err error) {
+	resp = new(UploadByURLResultResp)
+	err = PostAPI("/cgi-bin/media/get_upload_by_url_result", access_token, UploadByURLResultReq{JobID: jobid}, resp)
+	return resp, err
+}
+
+// WaitUploadByURL
+// @Description: 轮询异步上传任务直到完成或超时，返回的media_id仅可用于入群欢迎语素材，两次查询至少间隔1秒
+func WaitUploadByURL(access_token string, jobid string, interval time.Duration, timeout time.Duration) (mediaID string, err error) {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := GetUploadByURLResult(access_token, jobid)
+		if err != nil {
+			return "", err
+		}
+		switch resp.Status {
+		case UploadByURLStatusFinished:
+			return resp.Detail.MediaID, nil
+		case UploadByURLStatusFailed:
+			return "", &WecomError{ErrCode: resp.Detail.ErrCode, ErrMsg: resp.Detail.ErrMsg}
+		}
+		if time.Now().After(deadline) {
+			return "", errors.New("wait upload by url timeout: " + jobid)
+		}
+		time.Sleep(interval)
+	}
+}
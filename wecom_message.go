@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	TextContentMaxBytes     = 2048  // 文本消息内容最长字节数
+	MarkdownContentMaxBytes = 4096  // markdown消息内容最长字节数
+	DefaultTruncateSuffix   = "..." // 截断内容时默认追加的后缀
+)
+
+// 消息内容超长时的处理方式
+type OverflowMode int
+
+const (
+	OverflowError    OverflowMode = iota // 返回错误（默认）
+	OverflowSplit                        // 按段落/行拆分成多条带编号的消息依次发送
+	OverflowTruncate                     // 截断并追加后缀
+)
+
+// 构造文本/markdown消息时的内容选项
+type ContentOption struct {
+	Overflow   OverflowMode // 内容超长时的处理方式
+	Suffix     string       // 截断时追加的后缀，为空时使用DefaultTruncateSuffix
+	CommonMark bool         // 仅markdown消息：内容为标准CommonMark，发送前转换为企业微信markdown
+}
+
+// ***markdown消息 start***//
+// 发送markdown消息字段
+type SendMsgMarkdown struct {
+	SendMsgCommon
+	Markdown               Markdown `json:"markdown"`                 // 消息内容
+	EnableDuplicateCheck   int      `json:"enable_duplicate_check"`   // 是否开启重复消息检查
+	DuplicateCheckInterval int      `json:"duplicate_check_interval"` // 是否重复消息检查的时间间隔
+}
+
+// markdown消息内容
+type Markdown struct {
+	Content string `json:"content"` // markdown内容
+}
+
+// ***markdown消息 end***//
+
+// ***其他消息内容 start***//
+// 图片、语音、文件消息内容
+type Media struct {
+	MediaID string `json:"media_id"` // 媒体文件id，可以调用上传临时素材接口获取
+}
+
+// 视频消息内容
+type Video struct {
+	MediaID     string `json:"media_id"`              // 视频媒体文件id
+	Title       string `json:"title,omitempty"`       // 视频消息的标题
+	Description string `json:"description,omitempty"` // 视频消息的描述
+}
+
+// 文本卡片消息内容
+type TextCard struct {
+	Title       string `json:"title"`            // 标题
+	Description string `json:"description"`      // 描述，支持<div class="gray/normal/highlight">
+	URL         string `json:"url"`              // 点击后跳转的链接
+	BtnTxt      string `json:"btntxt,omitempty"` // 按钮文字，默认为“详情”
+}
+
+// 图文消息内容
+type News struct {
+	Articles []NewsArticle `json:"articles"` // 图文消息，一个图文消息支持1到8条图文
+}
+
+// 图文
+type NewsArticle struct {
+	Title       string `json:"title"`                 // 标题
+	Description string `json:"description,omitempty"` // 描述
+	URL         string `json:"url,omitempty"`         // 点击后跳转的链接
+	PicURL      string `json:"picurl,omitempty"`      // 图文消息的图片链接
+	AppID       string `json:"appid,omitempty"`       // 小程序appid，和url二选一
+	PagePath    string `json:"pagepath,omitempty"`    // 点击消息卡片后的小程序页面
+}
+
+// mpnews图文消息内容，图文内容存储在企业微信
+type MPNews struct {
+	Articles []MPNewsArticle `json:"articles"` // 图文消息，一个图文消息支持1到8条图文
+}
+
+// mpnews图文
+type MPNewsArticle struct {
+	Title            string `json:"title"`                        // 标题
+	ThumbMediaID     string `json:"thumb_media_id"`               // 图文消息缩略图的media_id
+	Author           string `json:"author,omitempty"`             // 图文消息的作者
+	ContentSourceURL string `json:"content_source_url,omitempty"` // 点击“阅读原文”之后的页面链接
+	Content          string `json:"content"`                      // 图文消息的内容，支持html标签
+	Digest           string `json:"digest,omitempty"`             // 图文消息的描述
+}
+
+// 按msgtype填写其中一种消息内容，用于群聊、互联企业等支持多种消息类型的接口
+type MsgContent struct {
+	Text     *Text     `json:"text,omitempty"`     // 文本消息
+	Image    *Media    `json:"image,omitempty"`    // 图片消息
+	Voice    *Media    `json:"voice,omitempty"`    // 语音消息
+	Video    *Video    `json:"video,omitempty"`    // 视频消息
+	File     *Media    `json:"file,omitempty"`     // 文件消息
+	TextCard *TextCard `json:"textcard,omitempty"` // 文本卡片消息
+	News     *News     `json:"news,omitempty"`     // 图文消息
+	MPNews   *MPNews   `json:"mpnews,omitempty"`   // mpnews图文消息
+	Markdown *Markdown `json:"markdown,omitempty"` // markdown消息
+}
+
+// InferMsgType
+// @Description: 按已填写的消息内容推断msgtype
+func (m MsgContent) InferMsgType() string {
+	switch {
+	case m.Text != nil:
+		return "text"
+	case m.Image != nil:
+		return "image"
+	case m.Voice != nil:
+		return "voice"
+	case m.Video != nil:
+		return "video"
+	case m.File != nil:
+		return "file"
+	case m.TextCard != nil:
+		return "textcard"
+	case m.News != nil:
+		return "news"
+	case m.MPNews != nil:
+		return "mpnews"
+	case m.Markdown != nil:
+		return "markdown"
+	}
+	return ""
+}
+
+// ***其他消息内容 end***//
+
+// NewSendMsgText
+// @Description: 构造文本消息，内容超长时按opt拆分或截断，返回的消息需按顺序发送
+func NewSendMsgText(common SendMsgCommon, content string, opt ContentOption) (msgs []SendMsgText, err error) {
+	parts, err := FitContent(content, TextContentMaxBytes, opt)
+	if err != nil {
+		return nil, err
+	}
+	common.MsgType = "text"
+	for _, part := range parts {
+		msgs = append(msgs, SendMsgText{
+			SendMsgCommon:          common,
+			Text:                   Text{Content: part},
+			DuplicateCheckInterval: 1800,
+		})
+	}
+	return msgs, nil
+}
+
+// NewSendMsgMarkdown
+// @Description: 构造markdown消息，内容超长时按opt拆分或截断，返回的消息需按顺序发送
+func NewSendMsgMarkdown(common SendMsgCommon, content string, opt ContentOption) (msgs []SendMsgMarkdown, err error) {
+	parts, err := FitMarkdown(content, opt)
+	if err != nil {
+		return nil, err
+	}
+	common.MsgType = "markdown"
+	for _, part := range parts {
+		msgs = append(msgs, SendMsgMarkdown{
+			SendMsgCommon:          common,
+			Markdown:               Markdown{Content: part},
+			DuplicateCheckInterval: 1800,
+		})
+	}
+	return msgs, nil
+}
+
+// SendMsgJSON
+// @Description: 序列化消息体后发送消息到企业微信接口
+func SendMsgJSON(access_token string, msg interface{}) (sendMsgResp *SendMsgResp, err error) {
+	msgJSON, err := json.Marshal(msg)
+	if err != nil {
+		fmt.Println("send message json err: ", err)
+		return nil, err
+	}
+	return SendMsg(access_token, bytes.NewReader(msgJSON))
+}
+
+// SendText
+// @Description: 发送文本消息，拆分后的多条消息按顺序发送，遇到错误即停止
+func SendText(access_token string, common SendMsgCommon, content string, opt ContentOption) (sendMsgResps []*SendMsgResp, err error) {
+	msgs, err := NewSendMsgText(common, content, opt)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		sendMsgResp, err := SendMsgJSON(access_token, msg)
+		if err != nil {
+			return sendMsgResps, err
+		}
+		sendMsgResps = append(sendMsgResps, sendMsgResp)
+	}
+	return sendMsgResps, nil
+}
+
+// SendMarkdown
+// @Description: 发送markdown消息，拆分后的多条消息按顺序发送，遇到错误即停止
+func SendMarkdown(access_token string, common SendMsgCommon, content string, opt ContentOption) (sendMsgResps []*SendMsgResp, err error) {
+	msgs, err := NewSendMsgMarkdown(common, content, opt)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range msgs {
+		sendMsgResp, err := SendMsgJSON(access_token, msg)
+		if err != nil {
+			return sendMsgResps, err
+		}
+		sendMsgResps = append(sendMsgResps, sendMsgResp)
+	}
+	return sendMsgResps, nil
+}
+
+// FitMarkdown
+// @Description: 按需转换CommonMark后，按markdown消息的字节上限处理内容
+func FitMarkdown(content string, opt ContentOption) (parts []string, err error) {
+	if opt.CommonMark {
+		content = ConvertCommonMark(content)
+	}
+	return FitContent(content, MarkdownContentMaxBytes, opt)
+}
+
+// FitContent
+// @Description: 按字节上限处理消息内容，未超长时原样返回
+func FitContent(content string, maxBytes int, opt ContentOption) (parts []string, err error) {
+	if len(content) <= maxBytes {
+		return []string{content}, nil
+	}
+	switch opt.Overflow {
+	case OverflowSplit:
+		return SplitContentNumbered(content, maxBytes), nil
+	case OverflowTruncate:
+		suffix := opt.Suffix
+		if suffix == "" {
+			suffix = DefaultTruncateSuffix
+		}
+		return []string{TruncateContent(content, maxBytes, suffix)}, nil
+	default:
+		return nil, errors.New("content exceeds " + strconv.Itoa(maxBytes) + " bytes: " + strconv.Itoa(len(content)))
+	}
+}
+
+// SplitContentNumbered
+// @Description: 拆分超长内容，并在每段前加上"(序号/总数)"，加上编号后每段仍不超过maxBytes
+func SplitContentNumbered(content string, maxBytes int) []string {
+	// 编号长度取决于总段数，总段数位数变化时重新拆分
+	digits := 1
+	for {
+		prefixLen := len(numberedPrefix(1, 1)) + 2*(digits-1)
+		parts := SplitContent(content, maxBytes-prefixLen)
+		if len(strconv.Itoa(len(parts))) > digits {
+			digits = len(strconv.Itoa(len(parts)))
+			continue
+		}
+		if len(parts) == 1 {
+			return parts
+		}
+		for i := range parts {
+			parts[i] = numberedPrefix(i+1, len(parts)) + parts[i]
+		}
+		return parts
+	}
+}
+
+func numberedPrefix(index, total int) string {
+	return "(" + strconv.Itoa(index) + "/" + strconv.Itoa(total) + ")\n"
+}
+
+// SplitContent
+// @Description: 按段落、行的边界拆分内容，每段不超过maxBytes；单行仍超长时按UTF-8字符边界切分
+func SplitContent(content string, maxBytes int) []string {
+	return splitBySeps(content, maxBytes, []string{"\n\n", "\n"})
+}
+
+func splitBySeps(content string, maxBytes int, seps []string) (parts []string) {
+	if len(content) <= maxBytes {
+		return []string{content}
+	}
+	if len(seps) == 0 {
+		return splitRunes(content, maxBytes)
+	}
+	sep := seps[0]
+	cur := ""
+	for _, segment := range strings.Split(content, sep) {
+		if cur != "" && len(cur)+len(sep)+len(segment) <= maxBytes {
+			cur += sep + segment
+			continue
+		}
+		if cur != "" {
+			parts = append(parts, cur)
+			cur = ""
+		}
+		if len(segment) <= maxBytes {
+			cur = segment
+			continue
+		}
+		// 单个片段超长，用更细的分隔符继续拆分
+		parts = append(parts, splitBySeps(segment, maxBytes, seps[1:])...)
+	}
+	if cur != "" {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// 按UTF-8字符边界切分，保证不会截断多字节字符
+func splitRunes(content string, maxBytes int) (parts []string) {
+	start := 0
+	for i := 0; i < len(content); {
+		_, size := utf8.DecodeRuneInString(content[i:])
+		if i+size-start > maxBytes && i > start {
+			parts = append(parts, content[start:i])
+			start = i
+		}
+		i += size
+	}
+	if start < len(content) {
+		parts = append(parts, content[start:])
+	}
+	return parts
+}
+
+// TruncateContent
+// @Description: 截断内容到maxBytes（含后缀），不会截断多字节字符
+func TruncateContent(content string, maxBytes int, suffix string) string {
+	if len(content) <= maxBytes {
+		return content
+	}
+	keep := maxBytes - len(suffix)
+	if keep <= 0 {
+		return TruncateContent(suffix, maxBytes, "")
+	}
+	for keep > 0 && !utf8.RuneStart(content[keep]) {
+		keep--
+	}
+	return content[:keep] + suffix
+}
+
+// 撤回应用消息请求字段
+type RecallMsgReq struct {
+	MsgID string `json:"msgid"` // 消息id，从发送消息接口返回
+}
+
+// RecallMsg
+// @Description: 撤回24小时内通过发送应用消息接口推送的消息
+func RecallMsg(access_token string, msgid string) (err error) {
+	return PostAPI("/cgi-bin/message/recall", access_token, RecallMsgReq{MsgID: msgid}, new(CommonResp))
+}
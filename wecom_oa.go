@@ -0,0 +1,424 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+// 批量获取审批单号一次查询的最大时间跨度
+const OAApprovalMaxSpan = 31 * 24 * time.Hour
+
+// 审批单状态
+const (
+	OASpStatusPending      = 1  // 审批中
+	OASpStatusApproved     = 2  // 已通过
+	OASpStatusRejected     = 3  // 已驳回
+	OASpStatusRevoked      = 4  // 已撤销
+	OASpStatusRevokedAfter = 6  // 通过后撤销
+	OASpStatusDeleted      = 7  // 已删除
+	OASpStatusPaid         = 10 // 已支付
+)
+
+// ***审批 start***//
+// 多语言文本
+type OAText struct {
+	Text string `json:"text" xml:"Text"` // 文字
+	Lang string `json:"lang" xml:"Lang"` // 语言，如zh_CN
+}
+
+// 获取审批模板详情请求字段
+type OATemplateDetailReq struct {
+	TemplateID string `json:"template_id"` // 模板id
+}
+
+// 审批模板控件属性
+type OATemplateControlProperty struct {
+	Control     string   `json:"control"`     // 控件类型：Text、Textarea、Number、Money、Date、Selector、Contact、Tips、File、Table等
+	ID          string   `json:"id"`          // 控件id
+	Title       []OAText `json:"title"`       // 控件名称
+	Placeholder []OAText `json:"placeholder"` // 控件说明
+	Require     int      `json:"require"`     // 是否必填：1-必填，0-非必填
+	UnPrint     int      `json:"un_print"`    // 是否参与打印：1-不参与，0-参与
+}
+
+// 审批模板控件
+type OATemplateControl struct {
+	Property OATemplateControlProperty `json:"property"` // 控件属性
+	Config   json.RawMessage           `json:"config"`   // 控件配置，按控件类型不同结构不同
+}
+
+// 审批模板内容
+type OATemplateContent struct {
+	Controls []OATemplateControl `json:"controls"` // 控件列表
+}
+
+// 获取审批模板详情响应字段
+type OATemplateDetailResp struct {
+	CommonResp
+	TemplateNames   []OAText          `json:"template_names"`   // 模板名称
+	TemplateContent OATemplateContent `json:"template_content"` // 模板控件信息
+}
+
+// 审批节点
+type OAApprover struct {
+	Attr   int      `json:"attr"`   // 节点审批方式：1-或签，2-会签
+	UserID []string `json:"userid"` // 审批节点审批人userid列表
+}
+
+// 审批申请控件值，按控件类型填写对应的字段
+type OAApplyValue struct {
+	Text        string            `json:"text,omitempty"`        // 文本/多行文本
+	NewNumber   string            `json:"new_number,omitempty"`  // 数字
+	NewMoney    string            `json:"new_money,omitempty"`   // 金额
+	Date        *OAApplyDate      `json:"date,omitempty"`        // 日期/日期+时间
+	Selector    *OAApplySelector  `json:"selector,omitempty"`    // 单选/多选
+	Members     []OAApplyMember   `json:"members,omitempty"`     // 成员
+	Departments []OAApplyDept     `json:"departments,omitempty"` // 部门
+	Files       []OAApplyFile     `json:"files,omitempty"`       // 附件
+	Children    []OAApplyTableRow `json:"children,omitempty"`    // 明细
+}
+
+// 日期控件值
+type OAApplyDate struct {
+	Type       string `json:"type"`        // 时间展示类型：day-日期，hour-日期+时间
+	STimestamp string `json:"s_timestamp"` // 时间戳字符串
+}
+
+// 单选/多选控件值
+type OAApplySelector struct {
+	Type    string          `json:"type"`    // 选择方式：single-单选，multi-多选
+	Options []OAApplyOption `json:"options"` // 选中的选项
+}
+
+// 单选/多选控件选项
+type OAApplyOption struct {
+	Key   string   `json:"key"`             // 选项key，可从模板详情中获取
+	Value []OAText `json:"value,omitempty"` // 选项值，获取审批详情时返回
+}
+
+// 成员控件值
+type OAApplyMember struct {
+	UserID string `json:"userid"`         // 成员userid
+	Name   string `json:"name,omitempty"` // 成员名
+}
+
+// 部门控件值
+type OAApplyDept struct {
+	OpenapiID string `json:"openapi_id"`     // 部门id
+	Name      string `json:"name,omitempty"` // 部门名
+}
+
+// 附件控件值
+type OAApplyFile struct {
+	FileID string `json:"file_id"` // 文件的media_id
+}
+
+// 明细控件的一行
+type OAApplyTableRow struct {
+	List []OAApplyContent `json:"list"` // 该行各控件的值
+}
+
+// 审批申请控件
+type OAApplyContent struct {
+	Control string       `json:"control"`         // 控件类型
+	ID      string       `json:"id"`              // 控件id
+	Title   []OAText     `json:"title,omitempty"` // 控件名称，获取审批详情时返回
+	Value   OAApplyValue `json:"value"`           // 控件值
+}
+
+// 审批申请数据
+type OAApplyData struct {
+	Contents []OAApplyContent `json:"contents"` // 审批申请详情，由多个表单控件及其内容组成
+}
+
+// 摘要信息
+type OASummary struct {
+	SummaryInfo []OAText `json:"summary_info"` // 摘要行信息
+}
+
+// 提交审批申请请求字段
+type OAApplyEventReq struct {
+	CreatorUserID       string       `json:"creator_userid"`              // 申请人userid
+	TemplateID          string       `json:"template_id"`                 // 模板id
+	UseTemplateApprover int          `json:"use_template_approver"`       // 审批人模式：0-指定审批人，1-使用模板中的审批流
+	ChooseDepartment    int          `json:"choose_department,omitempty"` // 提单人多部门时指定的提单部门id
+	Approver            []OAApprover `json:"approver,omitempty"`          // 审批流程，指定审批人模式时必填
+	Notifyer            []string     `json:"notifyer,omitempty"`          // 抄送人userid列表
+	NotifyType          int          `json:"notify_type,omitempty"`       // 抄送方式：1-提单时抄送，2-单据通过后抄送，3-提单和单据通过后抄送
+	ApplyData           OAApplyData  `json:"apply_data"`                  // 审批申请数据
+	SummaryList         []OASummary  `json:"summary_list"`                // 摘要信息，最多3行
+}
+
+// 提交审批申请响应字段
+type OAApplyEventResp struct {
+	CommonResp
+	SpNo string `json:"sp_no"` // 审批单号
+}
+
+// 批量获取审批单号的过滤条件
+type OAApprovalFilter struct {
+	Key   string `json:"key"`   // 筛选类型：template_id、creator、department、sp_status、record_type
+	Value string `json:"value"` // 筛选值
+}
+
+// 批量获取审批单号请求字段
+type OAApprovalInfoReq struct {
+	StartTime string             `json:"starttime"`         // 开始时间戳
+	EndTime   string             `json:"endtime"`           // 结束时间戳，与开始时间相差不能超过31天
+	NewCursor string             `json:"new_cursor"`        // 分页游标，首次不填
+	Size      int                `json:"size"`              // 一次拉取的数量，最大100
+	Filters   []OAApprovalFilter `json:"filters,omitempty"` // 过滤条件
+}
+
+// 批量获取审批单号响应字段
+type OAApprovalInfoResp struct {
+	CommonResp
+	SpNoList      []string `json:"sp_no_list"`      // 审批单号列表
+	NewNextCursor string   `json:"new_next_cursor"` // 下一页游标，为空时表示没有更多数据
+}
+
+// 获取审批详情请求字段
+type OAApprovalDetailReq struct {
+	SpNo string `json:"sp_no"` // 审批单号
+}
+
+// 审批申请人
+type OAApplyer struct {
+	UserID  string `json:"userid"`  // 申请人userid
+	PartyID string `json:"partyid"` // 申请人所在部门id
+}
+
+// 审批节点中审批人的处理情况
+type OASpRecordDetail struct {
+	Approver struct {
+		UserID string `json:"userid"` // 审批人userid
+	} `json:"approver"` // 审批人
+	Speech   string   `json:"speech"`    // 审批意见
+	SpStatus int      `json:"sp_status"` // 审批人的状态：1-审批中，2-已同意，3-已驳回，4-已转审
+	SpTime   int64    `json:"sptime"`    // 审批操作时间
+	MediaID  []string `json:"media_id"`  // 审批意见附件
+}
+
+// 审批节点
+type OASpRecord struct {
+	SpStatus     int                `json:"sp_status"`    // 审批节点状态：1-审批中，2-已同意，3-已驳回，4-已转审
+	ApproverAttr int                `json:"approverattr"` // 节点审批方式：1-或签，2-会签
+	Details      []OASpRecordDetail `json:"details"`      // 审批节点详情
+}
+
+// 审批备注
+type OAComment struct {
+	CommentUserInfo struct {
+		UserID string `json:"userid"` // 备注人userid
+	} `json:"commentUserInfo"` // 备注人
+	CommentTime    int64    `json:"commenttime"`    // 备注提交时间
+	CommentContent string   `json:"commentcontent"` // 备注文本内容
+	CommentID      string   `json:"commentid"`      // 备注id
+	MediaID        []string `json:"media_id"`       // 备注附件
+}
+
+// 审批单详情
+type OAApprovalDetail struct {
+	SpNo       string       `json:"sp_no"`       // 审批单号
+	SpName     string       `json:"sp_name"`     // 审批模板名称
+	SpStatus   int          `json:"sp_status"`   // 审批单状态
+	TemplateID string       `json:"template_id"` // 审批模板id
+	ApplyTime  int64        `json:"apply_time"`  // 审批申请提交时间
+	Applyer    OAApplyer    `json:"applyer"`     // 申请人
+	SpRecord   []OASpRecord `json:"sp_record"`   // 审批流程
+	Notifyer   []struct {
+		UserID string `json:"userid"` // 抄送人userid
+	} `json:"notifyer"` // 抄送人
+	ApplyData OAApplyData `json:"apply_data"` // 审批申请数据
+	Comments  []OAComment `json:"comments"`   // 审批备注
+}
+
+// 获取审批详情响应字段
+type OAApprovalDetailResp struct {
+	CommonResp
+	Info OAApprovalDetail `json:"info"` // 审批单详情
+}
+
+// 企业微信回调审批状态变化事件解密后的数据
+type ReqMsgContentSysApprovalChange struct {
+	CallbackEventCommon
+	ApprovalInfo OAApprovalChangeInfo `xml:"ApprovalInfo"` // 审批单信息
+}
+
+// 审批状态变化事件中的审批单信息
+type OAApprovalChangeInfo struct {
+	SpNo       string `xml:"SpNo"`       // 审批单号
+	SpName     string `xml:"SpName"`     // 审批模板名称
+	SpStatus   int    `xml:"SpStatus"`   // 审批单状态
+	TemplateID string `xml:"TemplateId"` // 审批模板id
+	ApplyTime  int64  `xml:"ApplyTime"`  // 审批申请提交时间
+	Applyer    struct {
+		UserID string `xml:"UserId"` // 申请人userid
+		Party  string `xml:"Party"`  // 申请人所在部门id
+	} `xml:"Applyer"` // 申请人
+	SpRecord []struct {
+		SpStatus     int `xml:"SpStatus"`     // 审批节点状态
+		ApproverAttr int `xml:"ApproverAttr"` // 节点审批方式：1-或签，2-会签
+		Details      []struct {
+			Approver struct {
+				UserID string `xml:"UserId"` // 审批人userid
+			} `xml:"Approver"` // 审批人
+			Speech   string `xml:"Speech"`   // 审批意见
+			SpStatus int    `xml:"SpStatus"` // 审批人的状态
+			SpTime   int64  `xml:"SpTime"`   // 审批操作时间
+		} `xml:"Details"` // 审批节点详情
+	} `xml:"SpRecord"` // 审批流程
+	Notifyer []struct {
+		UserID string `xml:"UserId"` // 抄送人userid
+	} `xml:"Notifyer"` // 抄送人
+	Comments []struct {
+		CommentUserInfo struct {
+			UserID string `xml:"UserId"` // 备注人userid
+		} `xml:"CommentUserInfo"` // 备注人
+		CommentTime    int64  `xml:"CommentTime"`    // 备注提交时间
+		CommentContent string `xml:"CommentContent"` // 备注文本内容
+		CommentID      string `xml:"CommentId"`      // 备注id
+	} `xml:"Comments"` // 审批备注
+	StatuChangeEvent int `xml:"StatuChangeEvent"` // 触发事件：1-提单，2-同意，3-驳回，4-转审，5-催办，6-撤销，8-通过后撤销，10-添加备注
+}
+
+// ***审批 end***//
+
+// 审批状态变化事件处理函数
+type OAApprovalChangeHandler func(event *ReqMsgContentSysApprovalChange)
+
+var (
+	oaApprovalMu       sync.RWMutex
+	oaApprovalHandlers = map[string][]OAApprovalChangeHandler{} // 模板id到处理函数，空字符串表示所有模板
+)
+
+func init() {
+	RegisterEventHandler("sys_approval_change", CallbackSysApprovalChange)
+}
+
+// Finished
+// @Description: 审批单是否已处于结束状态，包括已通过、已驳回、已撤销、通过后撤销、已删除和已支付，
+// 通过后撤销等状态会在已通过之后再次推送，处理函数需要按SpStatus区分
+func (info *OAApprovalChangeInfo) Finished() bool {
+	switch info.SpStatus {
+	case OASpStatusApproved, OASpStatusRejected, OASpStatusRevoked, OASpStatusRevokedAfter, OASpStatusDeleted, OASpStatusPaid:
+		return true
+	}
+	return false
+}
+
+// GetOATemplateDetail
+// @Description: 获取审批模板详情，可从中获取控件id和选项key用于提交审批申请
+func GetOATemplateDetail(access_token string, templateID string) (resp *OATemplateDetailResp, err error) {
+	resp = new(OATemplateDetailResp)
+	err = PostAPI("/cgi-bin/oa/gettemplatedetail", access_token, OATemplateDetailReq{TemplateID: templateID}, resp)
+	return resp, err
+}
+
+// ApplyOAEvent
+// @Description: 代申请人提交审批申请，返回审批单号
+func ApplyOAEvent(access_token string, req *OAApplyEventReq) (spNo string, err error) {
+	resp := new(OAApplyEventResp)
+	err = PostAPI("/cgi-bin/oa/applyevent", access_token, req, resp)
+	return resp.SpNo, err
+}
+
+// GetOAApprovalInfo
+// @Description: 批量获取一页审批单号，时间跨度不能超过31天
+func GetOAApprovalInfo(access_token string, req *OAApprovalInfoReq) (resp *OAApprovalInfoResp, err error) {
+	start, err := strconv.ParseInt(req.StartTime, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid approval starttime: " + req.StartTime)
+	}
+	end, err := strconv.ParseInt(req.EndTime, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid approval endtime: " + req.EndTime)
+	}
+	if end < start || time.Duration(end-start)*time.Second > OAApprovalMaxSpan {
+		return nil, errors.New("invalid approval time range: " + req.StartTime + "-" + req.EndTime)
+	}
+	resp = new(OAApprovalInfoResp)
+	err = PostAPI("/cgi-bin/oa/getapprovalinfo", access_token, req, resp)
+	return resp, err
+}
+
+// 审批单号分页迭代器
+type OAApprovalIterator struct {
+	cursorPager
+	page []string
+}
+
+// IterOAApprovals
+// @Description: 逐条遍历时间范围内的审批单号，时间跨度不能超过31天
+func IterOAApprovals(access_token string, start, end time.Time, filters []OAApprovalFilter) *OAApprovalIterator {
+	req := &OAApprovalInfoReq{
+		StartTime: strconv.FormatInt(start.Unix(), 10),
+		EndTime:   strconv.FormatInt(end.Unix(), 10),
+		Size:      100,
+		Filters:   filters,
+	}
+	it := new(OAApprovalIterator)
+	it.cursorPager = newCursorPager(func(cursor string) (int, string, error) {
+		req.NewCursor = cursor
+		resp, err := GetOAApprovalInfo(access_token, req)
+		if err != nil {
+			return 0, "", err
+		}
+		it.page = resp.SpNoList
+		return len(it.page), resp.NewNextCursor, nil
+	})
+	return it
+}
+
+func (it *OAApprovalIterator) Next() bool    { return it.next() }
+func (it *OAApprovalIterator) Value() string { return it.page[it.index] }
+func (it *OAApprovalIterator) Err() error    { return it.err }
+
+// GetOAApprovalDetail
+// @Description: 获取审批单详情
+func GetOAApprovalDetail(access_token string, spNo string) (detail *OAApprovalDetail, err error) {
+	resp := new(OAApprovalDetailResp)
+	err = PostAPI("/cgi-bin/oa/getapprovaldetail", access_token, OAApprovalDetailReq{SpNo: spNo}, resp)
+	return &resp.Info, err
+}
+
+// OnOAApprovalChange
+// @Description: 注册审批状态变化事件处理函数，templateID为空时处理所有模板的审批单
+func OnOAApprovalChange(templateID string, handler OAApprovalChangeHandler) {
+	oaApprovalMu.Lock()
+	defer oaApprovalMu.Unlock()
+	oaApprovalHandlers[templateID] = append(oaApprovalHandlers[templateID], handler)
+}
+
+// CallbackSysApprovalChange
+// @Description: 处理审批状态变化事件，异步调用注册的处理函数，回调需要在5秒内响应
+func CallbackSysApprovalChange(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMsgCrypt, req *CallbackReq, msg []byte) (httpStatus int, encryptMsg []byte, err error) {
+	reqMsgContent := new(ReqMsgContentSysApprovalChange)
+	err = xml.Unmarshal(msg, &reqMsgContent)
+	if err != nil {
+		fmt.Println("callback sys approval change unmarshal xml err: ", err)
+		return http.StatusBadRequest, nil, err
+	}
+	info := &reqMsgContent.ApprovalInfo
+	fmt.Println("callback sys approval change: ", info.SpNo, info.SpStatus, info.StatuChangeEvent)
+
+	oaApprovalMu.RLock()
+	handlers := append(append([]OAApprovalChangeHandler{}, oaApprovalHandlers[""]...), oaApprovalHandlers[info.TemplateID]...)
+	oaApprovalMu.RUnlock()
+
+	safeGo("sys approval change", func() {
+		for _, handler := range handlers {
+			handler(reqMsgContent)
+		}
+	})
+	return http.StatusOK, nil, nil
+}
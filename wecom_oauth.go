@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	OAuthScopeBase             = "snsapi_base"        // 静默授权，只能获取成员userid
+	OAuthScopePrivateInfo      = "snsapi_privateinfo" // 手动授权，可获取成员手机号、邮箱等敏感信息
+	oauthUserKeyPrefix         = "oauth_user:"        // 手动授权获取的成员敏感信息在存储中的key前缀
+	OAuthPrivateInfoCookieName = "wecom_privateinfo"  // 已跳转手动授权的cookie名，无法获取敏感信息时避免反复跳转
+)
+
+// ***网页授权登录 start***//
+// 获取访问用户身份响应字段，企业成员返回userid，非企业成员返回openid
+type OAuthUserInfoResp struct {
+	CommonResp
+	UserID         string `json:"userid"`          // 成员UserID
+	UserTicket     string `json:"user_ticket"`     // 成员票据，scope为snsapi_privateinfo时返回，用于获取成员敏感信息
+	OpenID         string `json:"openid"`          // 非企业成员的标识
+	ExternalUserID string `json:"external_userid"` // 外部联系人id，非企业成员且是企业的客户时返回
+}
+
+// 获取访问用户敏感信息请求字段
+type OAuthUserDetailReq struct {
+	UserTicket string `json:"user_ticket"` // 成员票据
+}
+
+// 访问用户敏感信息
+type OAuthUserDetail struct {
+	UserID  string `json:"userid"`   // 成员UserID
+	Gender  string `json:"gender"`   // 性别：0-未定义，1-男性，2-女性
+	Avatar  string `json:"avatar"`   // 头像url
+	QRCode  string `json:"qr_code"`  // 员工个人二维码
+	Mobile  string `json:"mobile"`   // 手机
+	Email   string `json:"email"`    // 邮箱
+	BizMail string `json:"biz_mail"` // 企业邮箱
+	Address string `json:"address"`  // 地址
+}
+
+// 获取访问用户敏感信息响应字段
+type OAuthUserDetailResp struct {
+	CommonResp
+	OAuthUserDetail
+}
+
+// ***网页授权登录 end***//
+
+// OAuthAuthorizeURL
+// @Description: 拼接网页授权链接，在企业微信内打开后跳转到redirectURI并带上code和state
+func OAuthAuthorizeURL(redirectURI string, scope string, state string) string {
+	// 企业微信要求参数按文档中的顺序排列
+	return "https://open.weixin.qq.com/connect/oauth2/authorize?appid=" + CorpID +
+		"&redirect_uri=" + url.QueryEscape(redirectURI) +
+		"&response_type=code&scope=" + scope +
+		"&state=" + url.QueryEscape(state) +
+		"&agentid=" + strconv.Itoa(AgentID) +
+		"#wechat_redirect"
+}
+
+// GetOAuthUserInfo
+// @Description: 用网页授权的code获取访问用户身份，code只能使用一次，5分钟未被使用自动过期
+func GetOAuthUserInfo(access_token string, code string) (resp *OAuthUserInfoResp, err error) {
+	resp = new(OAuthUserInfoResp)
+	err = GetAPI("/cgi-bin/auth/getuserinfo", access_token, url.Values{"code": {code}}, resp)
+	return resp, err
+}
+
+// GetOAuthUserDetail
+// @Description: 用user_ticket获取访问用户敏感信息
+func GetOAuthUserDetail(access_token string, userTicket string) (detail *OAuthUserDetail, err error) {
+	resp := new(OAuthUserDetailResp)
+	err = PostAPI("/cgi-bin/auth/getuserdetail", access_token, OAuthUserDetailReq{UserTicket: userTicket}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.OAuthUserDetail, nil
+}
+
+// GetSavedOAuthUserDetail
+// @Description: 获取手动授权登录时保存的成员敏感信息
+func GetSavedOAuthUserDetail(userid string) (detail *OAuthUserDetail, ok bool, err error) {
+	detail = new(OAuthUserDetail)
+	ok, err = StoreGetJSON(oauthUserKeyPrefix+userid, detail)
+	return detail, ok, err
+}
+
+// OAuthRequired
+// @Description: 企业微信内网页登录中间件，未登录时跳转授权，回调后校验state、换取userid并写入会话cookie，
+// 之后通过CurrentUserID获取userid；scope为snsapi_privateinfo时同时保存成员敏感信息，
+// 已登录但还没有保存敏感信息的成员（如通过snsapi_base登录）会重新跳转手动授权
+func OAuthRequired(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if session, ok := GetSession(c); ok && !needPrivateInfo(c, scope, session.UserID) {
+			c.Set(SessionUserIDKey, session.UserID)
+			c.Next()
+			return
+		}
+
+		code := c.Query("code")
+		if code == "" {
+			state, err := newLoginState(c)
+			if err != nil {
+				fmt.Println("oauth new state err: ", err)
+				ResponseString(c, http.StatusInternalServerError, err.Error())
+				c.Abort()
+				return
+			}
+			if scope == OAuthScopePrivateInfo {
+				setCookie(c, OAuthPrivateInfoCookieName, signValue(scope), LoginStateTTL)
+			}
+			c.Redirect(http.StatusFound, OAuthAuthorizeURL(BaseURL+c.Request.URL.RequestURI(), scope, state))
+			c.Abort()
+			return
+		}
+
+		if !checkLoginState(c, c.Query("state")) {
+			ResponseString(c, http.StatusForbidden, "invalid state")
+			c.Abort()
+			return
+		}
+		userid, err := oauthLogin(code)
+		if err != nil {
+			ResponseString(c, http.StatusForbidden, err.Error())
+			c.Abort()
+			return
+		}
+		if err = SetSession(c, userid); err != nil {
+			fmt.Println("oauth set session err: ", err)
+			ResponseString(c, http.StatusInternalServerError, err.Error())
+			c.Abort()
+			return
+		}
+
+		// 去掉code和state后跳回原页面，避免刷新时重复使用code
+		query := c.Request.URL.Query()
+		query.Del("code")
+		query.Del("state")
+		target := c.Request.URL.Path
+		if len(query) > 0 {
+			target += "?" + query.Encode()
+		}
+		c.Redirect(http.StatusFound, target)
+		c.Abort()
+	}
+}
+
+// 已登录成员是否需要重新跳转手动授权：scope为snsapi_privateinfo且没有保存的敏感信息，
+// 当前请求是授权回调，或最近没有跳转过手动授权（成员拒绝或接口不返回user_ticket时避免反复跳转）
+func needPrivateInfo(c *gin.Context, scope string, userid string) bool {
+	if scope != OAuthScopePrivateInfo {
+		return false
+	}
+	_, ok, err := GetSavedOAuthUserDetail(userid)
+	if err != nil {
+		fmt.Println("oauth get saved user detail err: ", err)
+		return false
+	}
+	if ok {
+		return false
+	}
+	if c.Query("code") != "" {
+		return true
+	}
+	cookie, err := c.Cookie(OAuthPrivateInfoCookieName)
+	if err != nil {
+		return true
+	}
+	_, tried := verifyValue(cookie)
+	return !tried
+}
+
+// 用code换取成员userid，有user_ticket时保存成员敏感信息
+func oauthLogin(code string) (userid string, err error) {
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		return "", err
+	}
+	info, err := GetOAuthUserInfo(access_token, code)
+	if err != nil {
+		return "", err
+	}
+	if info.UserID == "" {
+		return "", errors.New("not a member of the corp, openid: " + info.OpenID)
+	}
+	if info.UserTicket != "" {
+		detail, err := GetOAuthUserDetail(access_token, info.UserTicket)
+		if err != nil {
+			fmt.Println("oauth get user detail err: ", err)
+		} else if err = StoreSetJSON(oauthUserKeyPrefix+info.UserID, detail); err != nil {
+			fmt.Println("oauth save user detail err: ", err)
+		}
+	}
+	return info.UserID, nil
+}
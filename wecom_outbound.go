@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 发送记录在存储中的key前缀
+const outboundKeyPrefix = "outbound:"
+
+// 发送记录，按业务key保存一次发送产生的所有msgid（超长内容拆分后会有多条）
+type OutboundRecord struct {
+	BizKey     string         `json:"biz_key"`     // 业务key，由调用方指定
+	MsgIDs     []string       `json:"msgids"`      // 企业微信返回的消息id，撤回成功后移到Recalled
+	Recalled   []string       `json:"recalled"`    // 已撤回的消息id
+	Failed     map[string]int `json:"failed"`      // 无法撤回的消息id及返回码，如已在客户端撤回或超过24小时
+	SendTime   int64          `json:"send_time"`   // 发送时间戳
+	RecallTime int64          `json:"recall_time"` // 全部撤回完成的时间戳，未撤回为0
+}
+
+// 发送记录的读改写需要串行，避免并发发送和撤回丢失msgid
+var outboundMu sync.Mutex
+
+// RecordOutbound
+// @Description: 记录业务key对应的发送结果，同一业务key多次发送时追加msgid
+func RecordOutbound(bizKey string, sendMsgResps ...*SendMsgResp) (err error) {
+	outboundMu.Lock()
+	defer outboundMu.Unlock()
+	record, _, err := GetOutbound(bizKey)
+	if err != nil {
+		return err
+	}
+	record.BizKey = bizKey
+	record.SendTime = time.Now().Unix()
+	record.RecallTime = 0
+	for _, sendMsgResp := range sendMsgResps {
+		if sendMsgResp != nil && sendMsgResp.MsgID != "" {
+			record.MsgIDs = append(record.MsgIDs, sendMsgResp.MsgID)
+		}
+	}
+	return StoreSetJSON(outboundKeyPrefix+bizKey, record)
+}
+
+// GetOutbound
+// @Description: 获取业务key对应的发送记录
+func GetOutbound(bizKey string) (record *OutboundRecord, ok bool, err error) {
+	record = new(OutboundRecord)
+	ok, err = StoreGetJSON(outboundKeyPrefix+bizKey, record)
+	return record, ok, err
+}
+
+// SendMsgWithBizKey
+// @Description: 发送消息并按业务key记录msgid，便于之后撤回
+func SendMsgWithBizKey(access_token string, bizKey string, msg interface{}) (sendMsgResp *SendMsgResp, err error) {
+	sendMsgResp, err = SendMsgJSON(access_token, msg)
+	if err != nil {
+		return sendMsgResp, err
+	}
+	if bizKey != "" {
+		if err = RecordOutbound(bizKey, sendMsgResp); err != nil {
+			fmt.Println("record outbound err: ", err)
+		}
+	}
+	return sendMsgResp, nil
+}
+
+// RecallByBizKey
+// @Description: 撤回业务key对应的全部消息，每撤回一条就保存进度，失败后重试只撤回剩余的消息，
+// 不可重试的失败记录到Failed后继续撤回后面的消息
+func RecallByBizKey(access_token string, bizKey string) (err error) {
+	outboundMu.Lock()
+	defer outboundMu.Unlock()
+	record, ok, err := GetOutbound(bizKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("outbound record not found: " + bizKey)
+	}
+	if record.RecallTime != 0 {
+		return nil
+	}
+	for len(record.MsgIDs) > 0 {
+		msgid := record.MsgIDs[0]
+		err = RecallMsg(access_token, msgid)
+		if err != nil && isRecallRetryable(err) {
+			return err
+		}
+		record.MsgIDs = record.MsgIDs[1:]
+		if err != nil {
+			fmt.Println("recall msg err, skip: ", msgid, err)
+			if record.Failed == nil {
+				record.Failed = make(map[string]int)
+			}
+			var wecomErr *WecomError
+			errors.As(err, &wecomErr)
+			record.Failed[msgid] = wecomErr.ErrCode
+		} else {
+			record.Recalled = append(record.Recalled, msgid)
+		}
+		if err = StoreSetJSON(outboundKeyPrefix+bizKey, record); err != nil {
+			return err
+		}
+	}
+	record.RecallTime = time.Now().Unix()
+	return StoreSetJSON(outboundKeyPrefix+bizKey, record)
+}
+
+// 撤回错误是否可以重试，网络错误、token失效、频率限制和系统繁忙可以重试，
+// 其他企业微信返回码（如消息已撤回、超过撤回时限）重试也不会成功
+func isRecallRetryable(err error) bool {
+	var wecomErr *WecomError
+	if !errors.As(err, &wecomErr) {
+		return true
+	}
+	switch wecomErr.ErrCode {
+	case ErrCodeSystemBusy, ErrCodeInvalidAccessToken, ErrCodeAccessTokenExpired, ErrCodeAPIFreqOutOfLimit:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package main
+
+// 游标分页，供各类分页迭代器复用
+// fetch按cursor获取一页数据并保存在迭代器中，返回本页条数和下一页游标，游标为空表示最后一页
+type cursorPager struct {
+	fetch  func(cursor string) (size int, nextCursor string, err error)
+	cursor string // 下一页游标
+	index  int    // 当前条目在本页中的下标
+	size   int    // 本页条数
+	last   bool   // 是否已获取最后一页
+	err    error  // 获取数据时的错误
+}
+
+func newCursorPager(fetch func(cursor string) (size int, nextCursor string, err error)) cursorPager {
+	return cursorPager{fetch: fetch, index: -1}
+}
+
+// 移动到下一条，本页读完时获取下一页，没有更多数据或出错时返回false
+func (p *cursorPager) next() bool {
+	p.index++
+	for p.index >= p.size {
+		if p.err != nil || p.last {
+			return false
+		}
+		size, nextCursor, err := p.fetch(p.cursor)
+		if err != nil {
+			p.err = err
+			return false
+		}
+		p.size, p.index, p.cursor, p.last = size, 0, nextCursor, nextCursor == ""
+	}
+	return true
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"net/url"
+)
+
+// ***服务商 start***//
+// 获取服务商凭证请求字段
+type ProviderTokenReq struct {
+	CorpID         string `json:"corpid"`          // 服务商的corpid
+	ProviderSecret string `json:"provider_secret"` // 服务商的secret
+}
+
+// 获取服务商凭证响应字段
+type ProviderTokenResp struct {
+	CommonResp
+	ProviderAccessToken string `json:"provider_access_token"` // 服务商的access_token
+	ExpiresIn           int    `json:"expires_in"`            // 有效期（秒）
+}
+
+// 获取登录用户信息请求字段
+type LoginInfoReq struct {
+	AuthCode string `json:"auth_code"` // 扫码登录回调的auth_code
+}
+
+// 登录用户信息
+type LoginUserInfo struct {
+	UserID     string `json:"userid"`      // 登录用户的userid
+	OpenUserID string `json:"open_userid"` // 登录用户的open_userid
+	Name       string `json:"name"`        // 登录用户的名字
+	Avatar     string `json:"avatar"`      // 登录用户的头像
+}
+
+// 登录用户所在企业信息
+type LoginCorpInfo struct {
+	CorpID string `json:"corpid"` // 授权方企业id
+}
+
+// 登录用户在应用中的管理权限
+type LoginAgent struct {
+	AgentID  int `json:"agentid"`   // 应用id
+	AuthType int `json:"auth_type"` // 权限：0-使用权限，1-管理权限
+}
+
+// 登录用户的通讯录管理权限
+type LoginDepartment struct {
+	ID       int  `json:"id"`       // 部门id
+	Writable bool `json:"writable"` // 是否可写
+}
+
+// 登录用户的授权信息
+type LoginAuthInfo struct {
+	Department []LoginDepartment `json:"department"` // 管理的部门
+}
+
+// 获取登录用户信息响应字段
+type LoginInfoResp struct {
+	CommonResp
+	UserType int           `json:"usertype"`  // 登录用户的类型：1-创建者，2-内部系统管理员，3-外部系统管理员，4-分级管理员，5-成员
+	UserInfo LoginUserInfo `json:"user_info"` // 登录用户的信息
+	CorpInfo LoginCorpInfo `json:"corp_info"` // 授权方企业信息
+	Agent    []LoginAgent  `json:"agent"`     // 登录用户为管理员时在应用中的权限
+	AuthInfo LoginAuthInfo `json:"auth_info"` // 登录用户的通讯录权限
+}
+
+// corpid转换请求字段
+type OpenCorpIDReq struct {
+	CorpID string `json:"corpid"` // 待转换的corpid
+}
+
+// corpid转换响应字段
+type OpenCorpIDResp struct {
+	CommonResp
+	OpenCorpID string `json:"open_corpid"` // 该服务商主体下的加密corpid
+}
+
+// userid转换请求字段
+type OpenUserIDReq struct {
+	UserIDList []string `json:"userid_list"` // 待转换的userid列表，最多1000个
+}
+
+// userid与open_userid的对应关系
+type OpenUserID struct {
+	UserID     string `json:"userid"`      // 转换前的userid
+	OpenUserID string `json:"open_userid"` // 转换后的open_userid
+}
+
+// userid转换响应字段
+type OpenUserIDResp struct {
+	CommonResp
+	OpenUserIDList    []OpenUserID `json:"open_userid_list"`    // 转换成功的结果
+	InvalidUserIDList []string     `json:"invalid_userid_list"` // 不合法的userid
+}
+
+// 获取注册码请求字段
+type RegisterCodeReq struct {
+	TemplateID  string `json:"template_id"`            // 推广包id
+	CorpName    string `json:"corp_name,omitempty"`    // 企业名称
+	AdminName   string `json:"admin_name,omitempty"`   // 管理员姓名
+	AdminMobile string `json:"admin_mobile,omitempty"` // 管理员手机号
+	State       string `json:"state,omitempty"`        // 用户自定义的状态值，注册完成时原样返回
+	FollowUser  string `json:"follow_user,omitempty"`  // 跟进人的userid，需在服务商企业内
+}
+
+// 获取注册码响应字段
+type RegisterCodeResp struct {
+	CommonResp
+	RegisterCode string `json:"register_code"` // 注册码，只能消费一次
+	ExpiresIn    int    `json:"expires_in"`    // 有效期（秒）
+}
+
+// 查询注册状态请求字段
+type RegisterInfoReq struct {
+	RegisterCode string `json:"register_code"` // 注册码
+}
+
+// 通讯录同步凭证
+type ContactSync struct {
+	AccessToken string `json:"access_token"` // 通讯录api接口调用凭证，有全部通讯录读写权限
+	ExpiresIn   int    `json:"expires_in"`   // 有效期（秒）
+}
+
+// 查询注册状态响应字段
+type RegisterInfoResp struct {
+	CommonResp
+	CorpID       string       `json:"corpid"`         // 新注册企业的corpid
+	ContactSync  ContactSync  `json:"contact_sync"`   // 通讯录同步凭证
+	AuthUserInfo AuthUserInfo `json:"auth_user_info"` // 注册企业的管理员信息
+	State        string       `json:"state"`          // 获取注册码时填写的state
+}
+
+// ***服务商 end***//
+
+// 带provider_access_token参数的接口路径
+func providerPath(path string, providerAccessToken string) string {
+	return path + "?provider_access_token=" + url.QueryEscape(providerAccessToken)
+}
+
+// GetProviderAccessToken
+// @Description: 获取服务商凭证，带缓存
+func GetProviderAccessToken() (providerAccessToken string, err error) {
+	return Tokens.Get("provider_access_token:"+ProviderCorpID, func() (string, int, error) {
+		resp := new(ProviderTokenResp)
+		err := PostAPI("/cgi-bin/service/get_provider_token", "", ProviderTokenReq{CorpID: ProviderCorpID, ProviderSecret: ProviderSecret}, resp)
+		if err != nil {
+			return "", 0, err
+		}
+		return resp.ProviderAccessToken, resp.ExpiresIn, nil
+	})
+}
+
+// ProviderLoginURL
+// @Description: 拼接服务商后台扫码登录链接，企业管理员扫码后跳转到redirectURI并带上auth_code和state
+func ProviderLoginURL(redirectURI string, state string) string {
+	return "https://login.work.weixin.qq.com/wwlogin/sso/login?login_type=ServiceApp&appid=" + ProviderCorpID +
+		"&redirect_uri=" + url.QueryEscape(redirectURI) +
+		"&state=" + url.QueryEscape(state)
+}
+
+// GetLoginInfo
+// @Description: 用扫码登录的auth_code获取登录用户及其所在企业的信息
+func GetLoginInfo(providerAccessToken string, authCode string) (resp *LoginInfoResp, err error) {
+	resp = new(LoginInfoResp)
+	// 该接口的服务商凭证参数名为access_token
+	err = PostAPI("/cgi-bin/service/get_login_info", providerAccessToken, LoginInfoReq{AuthCode: authCode}, resp)
+	return resp, err
+}
+
+// CorpIDToOpenCorpID
+// @Description: 将企业的明文corpid转换为服务商主体下的加密corpid
+func CorpIDToOpenCorpID(providerAccessToken string, corpid string) (openCorpID string, err error) {
+	resp := new(OpenCorpIDResp)
+	err = PostAPI(providerPath("/cgi-bin/service/corpid_to_opencorpid", providerAccessToken), "", OpenCorpIDReq{CorpID: corpid}, resp)
+	return resp.OpenCorpID, err
+}
+
+// UserIDToOpenUserID
+// @Description: 将企业的明文userid转换为服务商主体下的open_userid，access_token为该企业的凭证，超过1000个时分批转换
+func UserIDToOpenUserID(access_token string, userids []string) (resp *OpenUserIDResp, err error) {
+	resp = new(OpenUserIDResp)
+	for start := 0; start < len(userids); start += 1000 {
+		end := start + 1000
+		if end > len(userids) {
+			end = len(userids)
+		}
+		batch := new(OpenUserIDResp)
+		err = PostAPI("/cgi-bin/batch/userid_to_openuserid", access_token, OpenUserIDReq{UserIDList: userids[start:end]}, batch)
+		if err != nil {
+			return resp, err
+		}
+		resp.OpenUserIDList = append(resp.OpenUserIDList, batch.OpenUserIDList...)
+		resp.InvalidUserIDList = append(resp.InvalidUserIDList, batch.InvalidUserIDList...)
+	}
+	return resp, nil
+}
+
+// GetRegisterCode
+// @Description: 获取推广注册码，用于拼接企业注册链接
+func GetRegisterCode(providerAccessToken string, req *RegisterCodeReq) (resp *RegisterCodeResp, err error) {
+	resp = new(RegisterCodeResp)
+	err = PostAPI(providerPath("/cgi-bin/service/get_register_code", providerAccessToken), "", req, resp)
+	return resp, err
+}
+
+// RegisterURL
+// @Description: 获取注册码并拼接企业注册链接，企业注册完成后自动安装推广包中的应用
+func RegisterURL(req *RegisterCodeReq) (registerURL string, registerCode string, err error) {
+	providerAccessToken, err := GetProviderAccessToken()
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := GetRegisterCode(providerAccessToken, req)
+	if err != nil {
+		return "", "", err
+	}
+	return "https://open.work.weixin.qq.com/3rdservice/wework/register?register_code=" + url.QueryEscape(resp.RegisterCode), resp.RegisterCode, nil
+}
+
+// GetRegisterInfo
+// @Description: 查询注册码对应的注册状态，未完成注册时返回错误
+func GetRegisterInfo(providerAccessToken string, registerCode string) (resp *RegisterInfoResp, err error) {
+	resp = new(RegisterInfoResp)
+	err = PostAPI(providerPath("/cgi-bin/service/get_register_info", providerAccessToken), "", RegisterInfoReq{RegisterCode: registerCode}, resp)
+	return resp, err
+}
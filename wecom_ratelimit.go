@@ -0,0 +1,53 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// 滑动窗口限流，window时间内最多limit次
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	times  []time.Time // 窗口内每次调用的时间，按时间顺序
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{limit: limit, window: window}
+}
+
+// Allow
+// @Description: 窗口内未达到上限时记录一次调用并返回true
+func (l *RateLimiter) Allow() bool {
+	return l.reserve() == 0
+}
+
+// Wait
+// @Description: 阻塞直到可以调用
+func (l *RateLimiter) Wait() {
+	for {
+		delay := l.reserve()
+		if delay == 0 {
+			return
+		}
+		time.Sleep(delay)
+	}
+}
+
+// 可以调用时记录本次调用并返回0，否则返回需要等待的时间
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	expired := 0
+	for expired < len(l.times) && now.Sub(l.times[expired]) >= l.window {
+		expired++
+	}
+	l.times = l.times[expired:]
+	if len(l.times) < l.limit {
+		l.times = append(l.times, now)
+		return 0
+	}
+	return l.window - now.Sub(l.times[0])
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	RelaySignTTL        = 5 * time.Minute // 转发接口签名时间戳允许的误差
+	RelayNonceMaxLen    = 64              // 转发接口随机串最大长度
+	relayNonceKeyPrefix = "relay_nonce:"  // 已使用的随机串在存储中的key前缀
+)
+
+// 随机串的检查和写入需要串行，避免并发重放同时通过
+var relayNonceMu sync.Mutex
+
+// 上次清理过期随机串的时间
+var relayNoncePurgeAt time.Time
+
+// 转发发送消息请求参数
+type RelaySendMsgReq struct {
+	BizKey string          `json:"biz_key"`                // 业务key，可选，用于之后按业务key撤回
+	Msg    json.RawMessage `json:"msg" binding:"required"` // 企业微信发送应用消息的请求体
+}
+
+// 撤回消息请求参数，msgid和biz_key二选一
+type RelayRecallMsgReq struct {
+	MsgID  string `json:"msgid"`   // 消息id
+	BizKey string `json:"biz_key"` // 业务key，撤回该key下发送的全部消息
+}
+
+// 更新模板卡片请求参数，replace_name和template_card二选一
+type RelayUpdateTemplateCardReq struct {
+	TaskID       string        `json:"task_id" binding:"required"` // 发送卡片时的任务id
+	UserIDs      []string      `json:"userids"`                    // 需要更新的成员，为空时更新全部接收人
+	ReplaceName  string        `json:"replace_name"`               // 按钮更新为不可点击状态后的文案
+	TemplateCard *TemplateCard `json:"template_card"`              // 替换后的卡片
+}
+
+// RelayAuthRequired
+// @Description: 校验业务系统调用转发接口的签名，请求头X-Relay-Timestamp为秒级时间戳，X-Relay-Nonce为每次请求不同的随机串，
+// X-Relay-Signature为hex(HMAC-SHA256(RelaySecret, 时间戳+"\n"+随机串+"\n"+请求方法+"\n"+请求路径及参数+"\n"+请求体))，
+// 同一随机串在签名有效期内只能使用一次，防止请求被截获后重放
+func RelayAuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timestamp := c.GetHeader("X-Relay-Timestamp")
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(ts, 0)) > RelaySignTTL || time.Until(time.Unix(ts, 0)) > RelaySignTTL {
+			ResponseJSON(c, http.StatusUnauthorized, 1, "invalid relay timestamp", nil)
+			c.Abort()
+			return
+		}
+		nonce := c.GetHeader("X-Relay-Nonce")
+		if nonce == "" || len(nonce) > RelayNonceMaxLen {
+			ResponseJSON(c, http.StatusUnauthorized, 1, "invalid relay nonce", nil)
+			c.Abort()
+			return
+		}
+		body, err := ioutil.ReadAll(c.Request.Body)
+		if err != nil {
+			ResponseJSON(c, http.StatusBadRequest, 1, err.Error(), nil)
+			c.Abort()
+			return
+		}
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		signature, err := hex.DecodeString(c.GetHeader("X-Relay-Signature"))
+		if err != nil || !hmac.Equal(signature, signRelay(timestamp, nonce, c.Request.Method, c.Request.URL.RequestURI(), body)) {
+			fmt.Println("relay auth fail: ", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			ResponseJSON(c, http.StatusUnauthorized, 1, "invalid relay signature", nil)
+			c.Abort()
+			return
+		}
+		if !useRelayNonce(nonce, time.Unix(ts, 0).Add(RelaySignTTL)) {
+			fmt.Println("relay replay rejected: ", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			ResponseJSON(c, http.StatusUnauthorized, 1, "relay nonce already used", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 计算转发接口的请求签名
+func signRelay(timestamp string, nonce string, method string, uri string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(RelaySecret))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + uri + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// 记录随机串直到expireAt，随机串在有效期内已使用过时返回false，每个签名有效期清理一次过期随机串
+func useRelayNonce(nonce string, expireAt time.Time) bool {
+	relayNonceMu.Lock()
+	defer relayNonceMu.Unlock()
+	now := time.Now()
+	if now.Sub(relayNoncePurgeAt) > RelaySignTTL {
+		relayNoncePurgeAt = now
+		for _, key := range Store.Keys(relayNonceKeyPrefix) {
+			var savedExpireAt int64
+			ok, err := StoreGetJSON(key, &savedExpireAt)
+			if err != nil || (ok && now.Unix() > savedExpireAt) {
+				Store.Delete(key)
+			}
+		}
+	}
+
+	key := relayNonceKeyPrefix + nonce
+	var savedExpireAt int64
+	ok, err := StoreGetJSON(key, &savedExpireAt)
+	if err != nil {
+		fmt.Println("relay nonce get err: ", err)
+	}
+	if ok && now.Unix() <= savedExpireAt {
+		return false
+	}
+	if err = StoreSetJSON(key, expireAt.Unix()); err != nil {
+		fmt.Println("relay nonce set err: ", err)
+	}
+	return true
+}
+
+// RelaySendMsg
+// @Description: 转发业务系统的消息到企业微信，并按业务key记录msgid
+func RelaySendMsg(c *gin.Context) {
+	req := new(RelaySendMsgReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		fmt.Println("relay send msg req err: ", err)
+		ResponseJSON(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		ResponseJSON(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	sendMsgResp, err := SendMsgWithBizKey(access_token, req.BizKey, req.Msg)
+	if err != nil {
+		ResponseJSON(c, http.StatusOK, 1, err.Error(), sendMsgResp)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, 0, "OK", sendMsgResp)
+}
+
+// RelayRecallMsg
+// @Description: 按msgid或业务key撤回消息
+func RelayRecallMsg(c *gin.Context) {
+	req := new(RelayRecallMsgReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		fmt.Println("relay recall msg req err: ", err)
+		ResponseJSON(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	if req.MsgID == "" && req.BizKey == "" {
+		ResponseJSON(c, http.StatusBadRequest, 1, "msgid or biz_key is required", nil)
+		return
+	}
+
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		ResponseJSON(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	if req.MsgID != "" {
+		err = RecallMsg(access_token, req.MsgID)
+	} else {
+		err = RecallByBizKey(access_token, req.BizKey)
+	}
+	if err != nil {
+		ResponseJSON(c, http.StatusOK, 1, err.Error(), nil)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, 0, "OK", nil)
+}
+
+// RelayUpdateTemplateCard
+// @Description: 按任务id主动更新模板卡片，如业务系统web端审批后同步卡片状态
+func RelayUpdateTemplateCard(c *gin.Context) {
+	req := new(RelayUpdateTemplateCardReq)
+	if err := c.ShouldBindJSON(req); err != nil {
+		fmt.Println("relay update template card req err: ", err)
+		ResponseJSON(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+	if req.ReplaceName == "" && req.TemplateCard == nil {
+		ResponseJSON(c, http.StatusBadRequest, 1, "replace_name or template_card is required", nil)
+		return
+	}
+
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		ResponseJSON(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	var resp *UpdateTemplateCardResp
+	if req.TemplateCard != nil {
+		resp, err = ReplaceTaskCard(access_token, req.TaskID, req.UserIDs, *req.TemplateCard)
+	} else {
+		resp, err = UpdateTaskCardButton(access_token, req.TaskID, req.UserIDs, req.ReplaceName)
+	}
+	if err != nil {
+		ResponseJSON(c, http.StatusOK, 1, err.Error(), resp)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, 0, "OK", resp)
+}
+
+// RelayStartApproval
+// @Description: 业务系统发起审批
+func RelayStartApproval(c *gin.Context) {
+	approval := new(Approval)
+	if err := c.ShouldBindJSON(approval); err != nil {
+		fmt.Println("relay start approval req err: ", err)
+		ResponseJSON(c, http.StatusBadRequest, 1, err.Error(), nil)
+		return
+	}
+
+	access_token, err := GetAppAccessToken()
+	if err != nil {
+		ResponseJSON(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	if err = StartApproval(access_token, approval); err != nil {
+		ResponseJSON(c, http.StatusOK, 1, err.Error(), nil)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, 0, "OK", approval)
+}
+
+// RelayGetApproval
+// @Description: 按任务id查询审批单
+func RelayGetApproval(c *gin.Context) {
+	approval, ok, err := GetApproval(c.Param("task_id"))
+	if err != nil {
+		ResponseJSON(c, http.StatusInternalServerError, 1, err.Error(), nil)
+		return
+	}
+	if !ok {
+		ResponseJSON(c, http.StatusNotFound, 1, "approval not found", nil)
+		return
+	}
+	ResponseJSON(c, http.StatusOK, 0, "OK", approval)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RobotMsgPerMinute   = 20               // 每个机器人每分钟最多发送的消息数
+	RobotImageMaxBytes  = 2 * 1024 * 1024  // 图片消息最大字节数（编码前）
+	RobotUploadMaxBytes = 20 * 1024 * 1024 // 机器人上传文件最大字节数
+)
+
+// ***群机器人消息 start***//
+// 群机器人消息，按msgtype填写对应的消息内容
+type RobotMsg struct {
+	MsgType      string        `json:"msgtype"`                 // 消息类型
+	Text         *RobotText    `json:"text,omitempty"`          // 文本消息
+	Markdown     *Markdown     `json:"markdown,omitempty"`      // markdown消息
+	Image        *RobotImage   `json:"image,omitempty"`         // 图片消息
+	News         *News         `json:"news,omitempty"`          // 图文消息
+	File         *Media        `json:"file,omitempty"`          // 文件消息，media_id通过机器人上传文件接口获取
+	TemplateCard *TemplateCard `json:"template_card,omitempty"` // 模板卡片消息
+}
+
+// 群机器人文本消息内容
+type RobotText struct {
+	Content             string   `json:"content"`                         // 文本内容
+	MentionedList       []string `json:"mentioned_list,omitempty"`        // 提醒群中的指定成员userid，@all表示提醒所有人
+	MentionedMobileList []string `json:"mentioned_mobile_list,omitempty"` // 提醒手机号对应的群成员，@all表示提醒所有人
+}
+
+// 群机器人图片消息内容
+type RobotImage struct {
+	Base64 string `json:"base64"` // 图片内容的base64编码
+	MD5    string `json:"md5"`    // 图片内容（base64编码前）的md5值
+}
+
+// ***群机器人消息 end***//
+
+// 群机器人，通过webhook key向已有群聊发送消息
+type RobotClient struct {
+	Key     string       // webhook地址中的key
+	Limiter *RateLimiter // 发送限流，默认每分钟20条
+}
+
+// 按webhook key共享的发送限流，同一个机器人创建多个RobotClient时合计不超过频率限制
+var (
+	robotLimitersMu sync.Mutex
+	robotLimiters   = map[string]*RateLimiter{}
+)
+
+// NewRobotClient
+// @Description: 创建群机器人，key为webhook地址中的key参数，相同key的客户端共用同一个限流
+func NewRobotClient(key string) *RobotClient {
+	return &RobotClient{
+		Key:     key,
+		Limiter: robotLimiter(key),
+	}
+}
+
+// 获取webhook key对应的限流，不存在时创建
+func robotLimiter(key string) *RateLimiter {
+	robotLimitersMu.Lock()
+	defer robotLimitersMu.Unlock()
+	limiter, ok := robotLimiters[key]
+	if !ok {
+		limiter = NewRateLimiter(RobotMsgPerMinute, time.Minute)
+		robotLimiters[key] = limiter
+	}
+	return limiter
+}
+
+// Send
+// @Description: 发送群机器人消息，超过频率限制时等待
+func (r *RobotClient) Send(msg *RobotMsg) (err error) {
+	r.Limiter.Wait()
+	return PostAPI("/cgi-bin/webhook/send?key="+url.QueryEscape(r.Key), "", msg, new(CommonResp))
+}
+
+// SendText
+// @Description: 发送文本消息，mentionedList为userid，mentionedMobileList为手机号；超长内容按opt拆分或截断，提醒仅附在第一条
+func (r *RobotClient) SendText(content string, mentionedList []string, mentionedMobileList []string, opt ContentOption) (err error) {
+	parts, err := FitContent(content, TextContentMaxBytes, opt)
+	if err != nil {
+		return err
+	}
+	for i, part := range parts {
+		text := &RobotText{Content: part}
+		if i == 0 {
+			text.MentionedList = mentionedList
+			text.MentionedMobileList = mentionedMobileList
+		}
+		if err = r.Send(&RobotMsg{MsgType: "text", Text: text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendMarkdown
+// @Description: 发送markdown消息，超长内容按opt拆分或截断后依次发送
+func (r *RobotClient) SendMarkdown(content string, opt ContentOption) (err error) {
+	parts, err := FitMarkdown(content, opt)
+	if err != nil {
+		return err
+	}
+	for _, part := range parts {
+		if err = r.Send(&RobotMsg{MsgType: "markdown", Markdown: &Markdown{Content: part}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendImage
+// @Description: 发送图片消息，支持jpg、png，最大2M
+func (r *RobotClient) SendImage(image []byte) (err error) {
+	if len(image) > RobotImageMaxBytes {
+		return errors.New("robot image exceeds 2M: " + strconv.Itoa(len(image)))
+	}
+	sum := md5.Sum(image)
+	return r.Send(&RobotMsg{MsgType: "image", Image: &RobotImage{
+		Base64: base64.StdEncoding.EncodeToString(image),
+		MD5:    hex.EncodeToString(sum[:]),
+	}})
+}
+
+// SendNews
+// @Description: 发送图文消息，支持1到8条图文
+func (r *RobotClient) SendNews(articles []NewsArticle) (err error) {
+	return r.Send(&RobotMsg{MsgType: "news", News: &News{Articles: articles}})
+}
+
+// SendFile
+// @Description: 上传文件并发送文件消息
+func (r *RobotClient) SendFile(fileName string, file io.Reader, size int64) (err error) {
+	uploadResp, err := r.UploadMedia("file", fileName, file, size)
+	if err != nil {
+		return err
+	}
+	return r.Send(&RobotMsg{MsgType: "file", File: &Media{MediaID: uploadResp.MediaID}})
+}
+
+// SendTemplateCard
+// @Description: 发送模板卡片消息，群机器人支持文本通知型和图文展示型
+func (r *RobotClient) SendTemplateCard(card *TemplateCard) (err error) {
+	return r.Send(&RobotMsg{MsgType: "template_card", TemplateCard: card})
+}
+
+// UploadMedia
+// @Description: 通过群机器人上传文件，mediaType固定为file，文件大小在5B~20M之间
+func (r *RobotClient) UploadMedia(mediaType string, fileName string, file io.Reader, size int64) (resp *UploadMediaResp, err error) {
+	if size < 5 || size > RobotUploadMaxBytes {
+		return nil, errors.New("robot upload size out of range: " + strconv.FormatInt(size, 10))
+	}
+	fmt.Println("upload robot media to wecom...")
+	path := "/cgi-bin/webhook/upload_media"
+	content, err := HttpPostMultipart(apiURL(path, "", url.Values{"key": {r.Key}, "type": {mediaType}}), "media", fileName, file, size)
+	if err != nil {
+		err = redactURLErr(err)
+		fmt.Println("upload robot media to wecom err: ", err)
+		return nil, err
+	}
+	resp = new(UploadMediaResp)
+	err = parseAPIResp(path, content, resp)
+	return resp, err
+}
+
+// SendFileBytes
+// @Description: 发送内存中的文件
+func (r *RobotClient) SendFileBytes(fileName string, data []byte) (err error) {
+	return r.SendFile(fileName, bytes.NewReader(data), int64(len(data)))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	SessionCookieName    = "wecom_session"     // 登录会话cookie名
+	SessionTTL           = 12 * time.Hour      // 登录会话有效期
+	LoginStateCookieName = "wecom_login_state" // 登录跳转前保存state的cookie名
+	LoginStateTTL        = 10 * time.Minute    // state有效期
+	SessionUserIDKey     = "userid"            // 登录后在gin.Context中保存userid的key
+)
+
+// 登录会话，签名后保存在cookie中
+type Session struct {
+	UserID   string `json:"userid"`    // 成员UserID
+	ExpireAt int64  `json:"expire_at"` // 过期时间戳
+}
+
+// SetSession
+// @Description: 登录成功后写入签名的会话cookie
+func SetSession(c *gin.Context, userid string) (err error) {
+	payload, err := json.Marshal(Session{UserID: userid, ExpireAt: time.Now().Add(SessionTTL).Unix()})
+	if err != nil {
+		return err
+	}
+	setCookie(c, SessionCookieName, signValue(base64.RawURLEncoding.EncodeToString(payload)), SessionTTL)
+	return nil
+}
+
+// GetSession
+// @Description: 读取并校验会话cookie，签名不匹配或已过期时返回false
+func GetSession(c *gin.Context) (session *Session, ok bool) {
+	cookie, err := c.Cookie(SessionCookieName)
+	if err != nil {
+		return nil, false
+	}
+	value, ok := verifyValue(cookie)
+	if !ok {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, false
+	}
+	session = new(Session)
+	if err = json.Unmarshal(payload, session); err != nil || session.UserID == "" {
+		return nil, false
+	}
+	if time.Now().Unix() >= session.ExpireAt {
+		return nil, false
+	}
+	return session, true
+}
+
+// ClearSession
+// @Description: 退出登录，删除会话cookie
+func ClearSession(c *gin.Context) {
+	setCookie(c, SessionCookieName, "", -1)
+}
+
+// CurrentUserID
+// @Description: 获取登录中间件保存的当前成员userid，未登录时为空
+func CurrentUserID(c *gin.Context) string {
+	return c.GetString(SessionUserIDKey)
+}
+
+// GetCurrentUser
+// @Description: 返回当前登录的成员userid
+func GetCurrentUser(c *gin.Context) {
+	ResponseJSON(c, http.StatusOK, 0, "ok", gin.H{"userid": CurrentUserID(c)})
+}
+
+// Logout
+// @Description: 退出登录，需使用POST并配合SameOriginRequired，防止第三方页面跨站触发
+func Logout(c *gin.Context) {
+	ClearSession(c)
+	ResponseJSON(c, http.StatusOK, 0, "ok", nil)
+}
+
+// SessionRequired
+// @Description: 要求已登录的中间件，未登录时返回401，可用于浏览器扫码登录的页面
+func SessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, ok := GetSession(c)
+		if !ok {
+			ResponseJSON(c, http.StatusUnauthorized, 1, "login required", nil)
+			c.Abort()
+			return
+		}
+		c.Set(SessionUserIDKey, session.UserID)
+		c.Next()
+	}
+}
+
+// SameOriginRequired
+// @Description: 校验请求来源的中间件，Origin（缺失时用Referer）必须与BaseURL同源，否则返回403，用于会话相关的写操作防止CSRF
+func SameOriginRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		source := c.GetHeader("Origin")
+		if source == "" {
+			source = c.GetHeader("Referer")
+		}
+		if !sameOrigin(source, BaseURL) {
+			ResponseJSON(c, http.StatusForbidden, 1, "cross-site request forbidden", nil)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 判断两个地址的scheme和host是否一致，任一地址无法解析时返回false
+func sameOrigin(a string, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
+	}
+	ub, err := url.Parse(b)
+	if err != nil || ub.Host == "" {
+		return false
+	}
+	return strings.EqualFold(ua.Scheme, ub.Scheme) && strings.EqualFold(ua.Host, ub.Host)
+}
+
+// 生成随机state并写入cookie，用于回调时校验防止CSRF
+func newLoginState(c *gin.Context) (state string, err error) {
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return "", err
+	}
+	state = hex.EncodeToString(b)
+	setCookie(c, LoginStateCookieName, signValue(state), LoginStateTTL)
+	return state, nil
+}
+
+// 校验回调中的state与cookie中保存的是否一致，校验后删除cookie，每个state只能使用一次
+func checkLoginState(c *gin.Context, state string) bool {
+	cookie, err := c.Cookie(LoginStateCookieName)
+	if err != nil || state == "" {
+		return false
+	}
+	setCookie(c, LoginStateCookieName, "", -1)
+	saved, ok := verifyValue(cookie)
+	return ok && hmac.Equal([]byte(saved), []byte(state))
+}
+
+// 写入HttpOnly cookie，SameSite=Lax使跨站的POST请求不携带会话，同时保留企业微信登录回调的顶层跳转
+func setCookie(c *gin.Context, name string, value string, ttl time.Duration) {
+	maxAge := int(ttl / time.Second)
+	if ttl < 0 {
+		maxAge = -1
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, "/", "", strings.HasPrefix(BaseURL, "https://"), true)
+}
+
+// 在值后面附加HMAC-SHA256签名，格式为"值.签名"
+func signValue(value string) string {
+	mac := hmac.New(sha256.New, []byte(SessionSecret))
+	mac.Write([]byte(value))
+	return value + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 校验签名并返回原始值
+func verifyValue(signed string) (value string, ok bool) {
+	i := strings.LastIndex(signed, ".")
+	if i < 0 {
+		return "", false
+	}
+	value = signed[:i]
+	return value, hmac.Equal([]byte(signValue(value)), []byte(signed))
+}
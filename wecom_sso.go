@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 扫码登录回调地址，域名需要与应用配置的可信域名一致
+const SSOCallbackPath = "/wecom/sso/callback"
+
+// SSOLoginURL
+// @Description: 拼接企业微信扫码登录链接，扫码确认后跳转到redirectURI并带上code和state
+func SSOLoginURL(redirectURI string, state string) string {
+	return "https://login.work.weixin.qq.com/wwlogin/sso/login?login_type=CorpApp&appid=" + CorpID +
+		"&agentid=" + strconv.Itoa(AgentID) +
+		"&redirect_uri=" + url.QueryEscape(redirectURI) +
+		"&state=" + url.QueryEscape(state)
+}
+
+// SSOLogin
+// @Description: 浏览器扫码登录入口，生成state后跳转到扫码登录页，登录后回到redirect参数指定的站内路径
+func SSOLogin(c *gin.Context) {
+	if _, ok := GetSession(c); ok {
+		c.Redirect(http.StatusFound, ssoRedirectTarget(c.Query("redirect")))
+		return
+	}
+	state, err := newLoginState(c)
+	if err != nil {
+		ResponseString(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	callback := BaseURL + SSOCallbackPath
+	if redirect := c.Query("redirect"); redirect != "" {
+		callback += "?redirect=" + url.QueryEscape(redirect)
+	}
+	c.Redirect(http.StatusFound, SSOLoginURL(callback, state))
+}
+
+// SSOCallback
+// @Description: 扫码登录回调，校验state后用code换取userid并写入与网页授权登录相同的会话cookie
+func SSOCallback(c *gin.Context) {
+	if !checkLoginState(c, c.Query("state")) {
+		ResponseString(c, http.StatusForbidden, "invalid state")
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		// 用户取消登录时不带code
+		ResponseString(c, http.StatusUnauthorized, "login canceled")
+		return
+	}
+	userid, err := oauthLogin(code)
+	if err != nil {
+		ResponseString(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err = SetSession(c, userid); err != nil {
+		ResponseString(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, ssoRedirectTarget(c.Query("redirect")))
+}
+
+// 只允许跳转到站内路径，防止被利用为开放重定向
+func ssoRedirectTarget(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+	return redirect
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 本地键值存储，用于保存发送记录、任务状态等需要跨请求使用的数据
+type KVStore interface {
+	Get(key string) (value string, ok bool)
+	Set(key string, value string) error
+	Delete(key string) error
+	Keys(prefix string) []string // 返回指定前缀的所有key，按字典序排列
+}
+
+// 全局存储，main中初始化为文件存储，失败时退回内存存储
+var Store KVStore = NewMemoryStore()
+
+// 内存存储
+type MemoryStore struct {
+	mu   sync.RWMutex
+	data map[string]string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: map[string]string{}}
+}
+
+func (s *MemoryStore) Get(key string) (value string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok = s.data[key]
+	return
+}
+
+func (s *MemoryStore) Set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func (s *MemoryStore) Keys(prefix string) (keys []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for k := range s.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// 文件存储，数据保存在内存中，每次修改后整体写入json文件
+type FileStore struct {
+	MemoryStore
+	path string
+}
+
+// NewFileStore
+// @Description: 创建文件存储，文件存在时加载已有数据
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: MemoryStore{data: map[string]string{}}, path: path}
+	content, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(content) > 0 {
+		if err = json.Unmarshal(content, &s.data); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *FileStore) Set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return s.save()
+}
+
+func (s *FileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return s.save()
+}
+
+// 先写临时文件再重命名，避免写入中断导致文件损坏
+func (s *FileStore) save() error {
+	content, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, content, 0600); err != nil {
+		fmt.Println("file store save err: ", err)
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// StoreGetJSON
+// @Description: 读取存储中的json数据
+func StoreGetJSON(key string, v interface{}) (ok bool, err error) {
+	value, ok := Store.Get(key)
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal([]byte(value), v)
+}
+
+// StoreSetJSON
+// @Description: 将数据序列化为json后写入存储
+func StoreSetJSON(key string, v interface{}) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return Store.Set(key, string(value))
+}
+
+// 按key加锁，用于同一业务key的读改写串行而不同key之间互不阻塞，没有持有者的锁会被删除
+type KeyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int // 持有或等待该锁的数量
+}
+
+func NewKeyedMutex() *KeyedMutex {
+	return &KeyedMutex{locks: map[string]*keyedLock{}}
+}
+
+// Lock
+// @Description: 获取key对应的锁，返回解锁函数
+func (m *KeyedMutex) Lock(key string) (unlock func()) {
+	m.mu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = new(keyedLock)
+		m.locks[key] = l
+	}
+	l.refs++
+	m.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		m.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sbzhu/weworkapi_golang/wxbizmsgcrypt"
+)
+
+const (
+	suiteTicketKeyPrefix = "suite_ticket:" // suite_ticket在存储中的key前缀
+	suiteAuthKeyPrefix   = "suite_auth:"   // 授权企业信息在存储中的key前缀
+)
+
+// ***第三方应用 start***//
+// 第三方应用指令回调解密后的数据，不同InfoType只带部分字段
+// InfoType: suite_ticket、create_auth、change_auth、cancel_auth
+type ReqMsgContentSuite struct {
+	SuiteID     string `xml:"SuiteId"`     // 第三方应用的suite_id
+	InfoType    string `xml:"InfoType"`    // 指令类型
+	TimeStamp   int64  `xml:"TimeStamp"`   // 时间戳
+	SuiteTicket string `xml:"SuiteTicket"` // suite_ticket，每十分钟推送一次，有效期30分钟
+	AuthCode    string `xml:"AuthCode"`    // 临时授权码，10分钟内有效，仅create_auth有
+	AuthCorpID  string `xml:"AuthCorpId"`  // 授权方的corpid，仅change_auth、cancel_auth有
+	State       string `xml:"State"`       // 安装链接中的state参数
+}
+
+// 获取第三方应用凭证请求字段
+type SuiteTokenReq struct {
+	SuiteID     string `json:"suite_id"`     // 第三方应用的suite_id
+	SuiteSecret string `json:"suite_secret"` // 第三方应用的secret
+	SuiteTicket string `json:"suite_ticket"` // 企业微信推送的suite_ticket
+}
+
+// 获取第三方应用凭证响应字段
+type SuiteTokenResp struct {
+	CommonResp
+	SuiteAccessToken string `json:"suite_access_token"` // 第三方应用的access_token
+	ExpiresIn        int    `json:"expires_in"`         // 有效期（秒）
+}
+
+// 获取预授权码响应字段
+type PreAuthCodeResp struct {
+	CommonResp
+	PreAuthCode string `json:"pre_auth_code"` // 预授权码，用于拼接安装链接
+	ExpiresIn   int    `json:"expires_in"`    // 有效期（秒）
+}
+
+// 设置授权配置请求字段
+type SetSessionInfoReq struct {
+	PreAuthCode string           `json:"pre_auth_code"` // 预授权码
+	SessionInfo SuiteSessionInfo `json:"session_info"`  // 本次授权过程中需要用到的会话信息
+}
+
+// 授权配置
+type SuiteSessionInfo struct {
+	AppID    []int `json:"appid,omitempty"` // 允许进行授权的应用id，不填或者填空数组都表示允许授权套件内所有应用
+	AuthType int   `json:"auth_type"`       // 授权类型：0-正式授权，1-测试授权
+}
+
+// 授权企业的永久授权码请求字段
+type SuiteAuthReq struct {
+	AuthCode      string `json:"auth_code,omitempty"`      // 临时授权码，换取永久授权码时填写
+	AuthCorpID    string `json:"auth_corpid,omitempty"`    // 授权方corpid
+	PermanentCode string `json:"permanent_code,omitempty"` // 永久授权码
+}
+
+// 授权方企业信息
+type AuthCorpInfo struct {
+	CorpID            string `json:"corpid"`               // 授权方企业微信id
+	CorpName          string `json:"corp_name"`            // 授权方企业简称
+	CorpType          string `json:"corp_type"`            // 授权方企业类型
+	CorpSquareLogoURL string `json:"corp_square_logo_url"` // 授权方企业方形头像
+	CorpUserMax       int    `json:"corp_user_max"`        // 授权方企业用户规模
+	CorpFullName      string `json:"corp_full_name"`       // 授权方企业的主体名称
+	VerifiedEndTime   int64  `json:"verified_end_time"`    // 认证到期时间
+	SubjectType       int    `json:"subject_type"`         // 企业类型：1-企业，2-政府以及事业单位，3-其他组织，4-团队号
+	CorpScale         string `json:"corp_scale"`           // 企业规模
+	CorpIndustry      string `json:"corp_industry"`        // 企业所属行业
+}
+
+// 授权的应用信息
+type AuthAgent struct {
+	AgentID         int    `json:"agentid"`           // 授权方应用id
+	Name            string `json:"name"`              // 授权方应用名字
+	SquareLogoURL   string `json:"square_logo_url"`   // 授权方应用方形头像
+	AuthMode        int    `json:"auth_mode"`         // 授权模式：0-管理员授权，1-成员授权
+	IsCustomizedApp bool   `json:"is_customized_app"` // 是否为代开发自建应用
+}
+
+// 授权信息
+type AuthInfo struct {
+	Agent []AuthAgent `json:"agent"` // 授权的应用列表
+}
+
+// 授权管理员信息
+type AuthUserInfo struct {
+	UserID     string `json:"userid"`      // 授权管理员的userid
+	OpenUserID string `json:"open_userid"` // 授权管理员的open_userid
+	Name       string `json:"name"`        // 授权管理员的名字
+	Avatar     string `json:"avatar"`      // 授权管理员的头像url
+}
+
+// 获取永久授权码响应字段
+type PermanentCodeResp struct {
+	CommonResp
+	AccessToken   string       `json:"access_token"`   // 授权方的access_token
+	ExpiresIn     int          `json:"expires_in"`     // access_token有效期（秒）
+	PermanentCode string       `json:"permanent_code"` // 企业微信永久授权码
+	AuthCorpInfo  AuthCorpInfo `json:"auth_corp_info"` // 授权方企业信息
+	AuthInfo      AuthInfo     `json:"auth_info"`      // 授权信息
+	AuthUserInfo  AuthUserInfo `json:"auth_user_info"` // 授权管理员的信息
+	State         string       `json:"state"`          // 安装链接中的state参数
+}
+
+// 获取授权信息响应字段
+type SuiteAuthInfoResp struct {
+	CommonResp
+	AuthCorpInfo AuthCorpInfo `json:"auth_corp_info"` // 授权方企业信息
+	AuthInfo     AuthInfo     `json:"auth_info"`      // 授权信息
+}
+
+// 获取企业凭证响应字段
+type CorpTokenResp struct {
+	CommonResp
+	AccessToken string `json:"access_token"` // 授权方的access_token
+	ExpiresIn   int    `json:"expires_in"`   // 有效期（秒）
+}
+
+// 保存的授权企业信息
+type SuiteAuthCorp struct {
+	PermanentCode string       `json:"permanent_code"` // 永久授权码
+	AuthCorpInfo  AuthCorpInfo `json:"auth_corp_info"` // 授权方企业信息
+	AuthInfo      AuthInfo     `json:"auth_info"`      // 授权信息
+	AuthUserInfo  AuthUserInfo `json:"auth_user_info"` // 授权管理员的信息
+}
+
+// ***第三方应用 end***//
+
+// 第三方应用指令回调处理函数
+type SuiteInfoHandler func(msg *ReqMsgContentSuite) error
+
+// 按InfoType注册的第三方应用指令回调处理函数
+var suiteInfoHandlers = map[string]SuiteInfoHandler{}
+
+func init() {
+	RegisterSuiteInfoHandler("suite_ticket", handleSuiteTicket)
+	RegisterSuiteInfoHandler("create_auth", handleCreateAuth)
+	RegisterSuiteInfoHandler("change_auth", handleChangeAuth)
+	RegisterSuiteInfoHandler("cancel_auth", handleCancelAuth)
+}
+
+// RegisterSuiteInfoHandler
+// @Description: 注册第三方应用指令回调处理函数，同一InfoType重复注册时覆盖
+func RegisterSuiteInfoHandler(infoType string, handler SuiteInfoHandler) {
+	suiteInfoHandlers[infoType] = handler
+}
+
+// 带suite_access_token参数的接口路径
+func suitePath(path string, suiteAccessToken string) string {
+	return path + "?suite_access_token=" + url.QueryEscape(suiteAccessToken)
+}
+
+// GetSuiteTicket
+// @Description: 获取保存的suite_ticket
+func GetSuiteTicket() (ticket string, err error) {
+	ticket, ok := Store.Get(suiteTicketKeyPrefix + SuiteID)
+	if !ok {
+		return "", errors.New("suite_ticket not received yet: " + SuiteID)
+	}
+	return ticket, nil
+}
+
+// GetSuiteAccessToken
+// @Description: 获取第三方应用凭证，带缓存
+func GetSuiteAccessToken() (suiteAccessToken string, err error) {
+	return Tokens.Get("suite_access_token:"+SuiteID, func() (string, int, error) {
+		ticket, err := GetSuiteTicket()
+		if err != nil {
+			return "", 0, err
+		}
+		resp := new(SuiteTokenResp)
+		err = PostAPI("/cgi-bin/service/get_suite_token", "", SuiteTokenReq{SuiteID: SuiteID, SuiteSecret: SuiteSecret, SuiteTicket: ticket}, resp)
+		if err != nil {
+			return "", 0, err
+		}
+		return resp.SuiteAccessToken, resp.ExpiresIn, nil
+	})
+}
+
+// GetPreAuthCode
+// @Description: 获取预授权码，用于拼接应用安装链接
+func GetPreAuthCode(suiteAccessToken string) (preAuthCode string, err error) {
+	resp := new(PreAuthCodeResp)
+	err = GetAPI(suitePath("/cgi-bin/service/get_pre_auth_code", suiteAccessToken), "", nil, resp)
+	return resp.PreAuthCode, err
+}
+
+// SetSessionInfo
+// @Description: 设置本次授权的配置，如限制可授权的应用、使用测试授权
+func SetSessionInfo(suiteAccessToken string, preAuthCode string, info SuiteSessionInfo) (err error) {
+	return PostAPI(suitePath("/cgi-bin/service/set_session_info", suiteAccessToken), "", SetSessionInfoReq{PreAuthCode: preAuthCode, SessionInfo: info}, new(CommonResp))
+}
+
+// SuiteInstallURL
+// @Description: 获取预授权码并拼接应用安装链接，企业管理员授权后跳转到redirectURI并带上auth_code和state
+func SuiteInstallURL(redirectURI string, state string) (installURL string, err error) {
+	suiteAccessToken, err := GetSuiteAccessToken()
+	if err != nil {
+		return "", err
+	}
+	preAuthCode, err := GetPreAuthCode(suiteAccessToken)
+	if err != nil {
+		return "", err
+	}
+	return "https://open.work.weixin.qq.com/3rdapp/install?suite_id=" + SuiteID +
+		"&pre_auth_code=" + url.QueryEscape(preAuthCode) +
+		"&redirect_uri=" + url.QueryEscape(redirectURI) +
+		"&state=" + url.QueryEscape(state), nil
+}
+
+// GetPermanentCode
+// @Description: 用临时授权码换取永久授权码，同时返回授权企业的access_token
+func GetPermanentCode(suiteAccessToken string, authCode string) (resp *PermanentCodeResp, err error) {
+	resp = new(PermanentCodeResp)
+	err = PostAPI(suitePath("/cgi-bin/service/get_permanent_code", suiteAccessToken), "", SuiteAuthReq{AuthCode: authCode}, resp)
+	return resp, err
+}
+
+// GetSuiteAuthInfo
+// @Description: 获取企业的授权信息
+func GetSuiteAuthInfo(suiteAccessToken string, authCorpID string, permanentCode string) (resp *SuiteAuthInfoResp, err error) {
+	resp = new(SuiteAuthInfoResp)
+	err = PostAPI(suitePath("/cgi-bin/service/get_auth_info", suiteAccessToken), "", SuiteAuthReq{AuthCorpID: authCorpID, PermanentCode: permanentCode}, resp)
+	return resp, err
+}
+
+// GetSuiteAuthCorp
+// @Description: 获取保存的授权企业信息
+func GetSuiteAuthCorp(authCorpID string) (corp *SuiteAuthCorp, ok bool, err error) {
+	corp = new(SuiteAuthCorp)
+	ok, err = StoreGetJSON(suiteAuthKeyPrefix+SuiteID+":"+authCorpID, corp)
+	return corp, ok, err
+}
+
+// ListSuiteAuthCorpIDs
+// @Description: 获取全部已授权企业的corpid
+func ListSuiteAuthCorpIDs() (corpids []string) {
+	prefix := suiteAuthKeyPrefix + SuiteID + ":"
+	for _, key := range Store.Keys(prefix) {
+		corpids = append(corpids, key[len(prefix):])
+	}
+	return corpids
+}
+
+func saveSuiteAuthCorp(corp *SuiteAuthCorp) error {
+	return StoreSetJSON(suiteAuthKeyPrefix+SuiteID+":"+corp.AuthCorpInfo.CorpID, corp)
+}
+
+func corpTokenKey(authCorpID string) string {
+	return "corp_access_token:" + SuiteID + ":" + authCorpID
+}
+
+// GetCorpAccessToken
+// @Description: 获取授权企业的access_token，带缓存，可直接用于调用该企业的接口
+func GetCorpAccessToken(authCorpID string) (access_token string, err error) {
+	return Tokens.Get(corpTokenKey(authCorpID), func() (string, int, error) {
+		corp, ok, err := GetSuiteAuthCorp(authCorpID)
+		if err != nil {
+			return "", 0, err
+		}
+		if !ok {
+			return "", 0, errors.New("corp not authorized: " + authCorpID)
+		}
+		suiteAccessToken, err := GetSuiteAccessToken()
+		if err != nil {
+			return "", 0, err
+		}
+		resp := new(CorpTokenResp)
+		err = PostAPI(suitePath("/cgi-bin/service/get_corp_token", suiteAccessToken), "", SuiteAuthReq{AuthCorpID: authCorpID, PermanentCode: corp.PermanentCode}, resp)
+		if err != nil {
+			return "", 0, err
+		}
+		return resp.AccessToken, resp.ExpiresIn, nil
+	})
+}
+
+// 保存suite_ticket
+func handleSuiteTicket(msg *ReqMsgContentSuite) error {
+	return Store.Set(suiteTicketKeyPrefix+msg.SuiteID, msg.SuiteTicket)
+}
+
+// 企业授权安装应用，用临时授权码换取并保存永久授权码
+func handleCreateAuth(msg *ReqMsgContentSuite) error {
+	suiteAccessToken, err := GetSuiteAccessToken()
+	if err != nil {
+		return err
+	}
+	resp, err := GetPermanentCode(suiteAccessToken, msg.AuthCode)
+	if err != nil {
+		return err
+	}
+	err = saveSuiteAuthCorp(&SuiteAuthCorp{
+		PermanentCode: resp.PermanentCode,
+		AuthCorpInfo:  resp.AuthCorpInfo,
+		AuthInfo:      resp.AuthInfo,
+		AuthUserInfo:  resp.AuthUserInfo,
+	})
+	if err != nil {
+		return err
+	}
+	if resp.AccessToken != "" {
+		Tokens.Set(corpTokenKey(resp.AuthCorpInfo.CorpID), resp.AccessToken, resp.ExpiresIn)
+	}
+	fmt.Println("suite create auth: ", resp.AuthCorpInfo.CorpID, resp.AuthCorpInfo.CorpName)
+	return nil
+}
+
+// 企业变更授权，重新获取并保存授权信息
+func handleChangeAuth(msg *ReqMsgContentSuite) error {
+	corp, ok, err := GetSuiteAuthCorp(msg.AuthCorpID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("change_auth for unknown corp: " + msg.AuthCorpID)
+	}
+	suiteAccessToken, err := GetSuiteAccessToken()
+	if err != nil {
+		return err
+	}
+	resp, err := GetSuiteAuthInfo(suiteAccessToken, msg.AuthCorpID, corp.PermanentCode)
+	if err != nil {
+		return err
+	}
+	corp.AuthCorpInfo = resp.AuthCorpInfo
+	corp.AuthInfo = resp.AuthInfo
+	return saveSuiteAuthCorp(corp)
+}
+
+// 企业取消授权，删除永久授权码和缓存的access_token
+func handleCancelAuth(msg *ReqMsgContentSuite) error {
+	Tokens.Invalidate(corpTokenKey(msg.AuthCorpID))
+	return Store.Delete(suiteAuthKeyPrefix + SuiteID + ":" + msg.AuthCorpID)
+}
+
+// VerifySuiteURL
+// @Description: 验证第三方应用指令回调URL，验证时receiveid为服务商的corpid
+func VerifySuiteURL(c *gin.Context) {
+	req := new(VerifyURLReq)
+	if err := c.ShouldBindQuery(&req); err != nil {
+		fmt.Println("verify suite url err: ", err)
+		ResponseString(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	wxcpt := wxbizmsgcrypt.NewWXBizMsgCrypt(SuiteToken, SuiteEncodingAeskey, ProviderCorpID, wxbizmsgcrypt.XmlType)
+	echoStr, cryptErr := wxcpt.VerifyURL(req.MsgSignature, strconv.Itoa(req.Timestamp), req.Nonce, req.EchoStr)
+	if cryptErr != nil {
+		errStr := strconv.Itoa(cryptErr.ErrCode) + cryptErr.ErrMsg
+		fmt.Println("verify suite url fail: ", errStr)
+		ResponseString(c, http.StatusBadRequest, errStr)
+		return
+	}
+	ResponseString(c, http.StatusOK, string(echoStr))
+}
+
+// SuiteCallback
+// @Description: 接收第三方应用指令回调，需要在1秒内响应success，耗时的处理异步进行
+func SuiteCallback(c *gin.Context) {
+	req := new(CallbackReq)
+	if err := c.ShouldBindQuery(&req); err != nil {
+		fmt.Println("suite callback req params err: ", err)
+		ResponseString(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	reqData, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		fmt.Println("suite callback req body err: ", err)
+		ResponseString(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 接收指令回调时receiveid为suite_id
+	wxcpt := wxbizmsgcrypt.NewWXBizMsgCrypt(SuiteToken, SuiteEncodingAeskey, SuiteID, wxbizmsgcrypt.XmlType)
+	msg, cryptErr := wxcpt.DecryptMsg(req.MsgSignature, strconv.Itoa(req.Timestamp), req.Nonce, reqData)
+	if cryptErr != nil {
+		errStr := strconv.Itoa(cryptErr.ErrCode) + cryptErr.ErrMsg
+		fmt.Println("suite callback decrypt msg err: ", errStr)
+		ResponseString(c, http.StatusBadRequest, errStr)
+		return
+	}
+
+	reqMsgContent := new(ReqMsgContentSuite)
+	if err = xml.Unmarshal(msg, reqMsgContent); err != nil {
+		fmt.Println("suite callback unmarshal xml err: ", err)
+		ResponseString(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	fmt.Println("suite callback: ", reqMsgContent.InfoType, reqMsgContent.AuthCorpID)
+
+	handler, ok := suiteInfoHandlers[reqMsgContent.InfoType]
+	if !ok {
+		fmt.Println("suite callback unhandled info type: ", reqMsgContent.InfoType)
+	} else {
+		safeGo("suite callback", func() {
+			if err := handler(reqMsgContent); err != nil {
+				fmt.Println("suite callback "+reqMsgContent.InfoType+" err: ", err)
+			}
+		})
+	}
+	ResponseString(c, http.StatusOK, "success")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// ***通讯录标签 start***//
+// 标签信息
+type Tag struct {
+	TagID   int    `json:"tagid,omitempty"` // 标签id
+	TagName string `json:"tagname"`         // 标签名称
+}
+
+// 创建标签响应字段
+type CreateTagResp struct {
+	CommonResp
+	TagID int `json:"tagid"` // 标签id
+}
+
+// 获取标签成员响应字段
+type GetTagResp struct {
+	CommonResp
+	TagName   string `json:"tagname"`   // 标签名
+	UserList  []User `json:"userlist"`  // 标签中包含的成员列表，仅有userid和name
+	PartyList []int  `json:"partylist"` // 标签中包含的部门id列表
+}
+
+// 增加/删除标签成员请求字段
+type TagUsersReq struct {
+	TagID     int      `json:"tagid"`               // 标签id
+	UserList  []string `json:"userlist,omitempty"`  // 企业成员id列表
+	PartyList []int    `json:"partylist,omitempty"` // 企业部门id列表
+}
+
+// 增加/删除标签成员响应字段
+type TagUsersResp struct {
+	CommonResp
+	InvalidList  string `json:"invalidlist"`  // 非法的成员帐号列表
+	InvalidParty []int  `json:"invalidparty"` // 非法的部门id列表
+}
+
+// 标签列表响应字段
+type TagListResp struct {
+	CommonResp
+	TagList []Tag `json:"taglist"` // 标签列表
+}
+
+// ***通讯录标签 end***//
+
+// CreateTag
+// @Description: 创建标签，tagID为0时自动分配，返回标签id
+func CreateTag(access_token string, tagName string, tagID int) (id int, err error) {
+	resp := new(CreateTagResp)
+	err = PostAPI("/cgi-bin/tag/create", access_token, Tag{TagID: tagID, TagName: tagName}, resp)
+	return resp.TagID, err
+}
+
+// UpdateTag
+// @Description: 更新标签名字
+func UpdateTag(access_token string, tagID int, tagName string) (err error) {
+	return PostAPI("/cgi-bin/tag/update", access_token, Tag{TagID: tagID, TagName: tagName}, new(CommonResp))
+}
+
+// DeleteTag
+// @Description: 删除标签
+func DeleteTag(access_token string, tagID int) (err error) {
+	return GetAPI("/cgi-bin/tag/delete", access_token, url.Values{"tagid": {strconv.Itoa(tagID)}}, new(CommonResp))
+}
+
+// GetTag
+// @Description: 获取标签成员
+func GetTag(access_token string, tagID int) (resp *GetTagResp, err error) {
+	resp = new(GetTagResp)
+	err = GetAPI("/cgi-bin/tag/get", access_token, url.Values{"tagid": {strconv.Itoa(tagID)}}, resp)
+	return resp, err
+}
+
+// AddTagUsers
+// @Description: 增加标签成员，userlist和partylist不能同时为空
+func AddTagUsers(access_token string, req *TagUsersReq) (resp *TagUsersResp, err error) {
+	resp = new(TagUsersResp)
+	err = PostAPI("/cgi-bin/tag/addtagusers", access_token, req, resp)
+	return resp, err
+}
+
+// DelTagUsers
+// @Description: 删除标签成员，userlist和partylist不能同时为空
+func DelTagUsers(access_token string, req *TagUsersReq) (resp *TagUsersResp, err error) {
+	resp = new(TagUsersResp)
+	err = PostAPI("/cgi-bin/tag/deltagusers", access_token, req, resp)
+	return resp, err
+}
+
+// ListTag
+// @Description: 获取标签列表
+func ListTag(access_token string) (tags []Tag, err error) {
+	resp := new(TagListResp)
+	err = GetAPI("/cgi-bin/tag/list", access_token, nil, resp)
+	return resp.TagList, err
+}
+
+// FindTagByName
+// @Description: 在标签列表中按名称查找标签id
+func FindTagByName(tags []Tag, tagName string) (id int, err error) {
+	for _, tag := range tags {
+		if tag.TagName == tagName {
+			return tag.TagID, nil
+		}
+	}
+	return 0, errors.New("tag not found: " + tagName)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 模板卡片response_code在存储中的key前缀
+const responseCodeKeyPrefix = "response_code:"
+
+// response_code有效期，只能在72小时内使用一次
+const ResponseCodeTTL = 72 * time.Hour
+
+// 更新模板卡片消息请求字段
+type UpdateTemplateCardReq struct {
+	UserIDs      []string          `json:"userids,omitempty"`       // 企业的成员ID列表
+	PartyIDs     []int             `json:"partyids,omitempty"`      // 企业的部门ID列表
+	TagIDs       []int             `json:"tagids,omitempty"`        // 企业的标签ID列表
+	AtAll        int               `json:"atall,omitempty"`         // 更新整个任务接收人员
+	AgentID      int               `json:"agentid"`                 // 企业应用的id
+	ResponseCode string            `json:"response_code"`           // 更新卡片所需要消费的code
+	Button       *UpdateButtonName `json:"button,omitempty"`        // 更新按钮为不可点击状态
+	TemplateCard *TemplateCard     `json:"template_card,omitempty"` // 更新为新的卡片
+}
+
+// 更新按钮文案
+type UpdateButtonName struct {
+	ReplaceName string `json:"replace_name"` // 需要更新的按钮的文案
+}
+
+// 更新模板卡片消息响应字段
+type UpdateTemplateCardResp struct {
+	CommonResp
+	InvalidUser []string `json:"invaliduser"` // 不合法的userid
+}
+
+// 任务卡片最近一次可用的response_code
+type ResponseCodeRecord struct {
+	TaskID       string `json:"task_id"`       // 任务id
+	ResponseCode string `json:"response_code"` // 更新卡片所需要消费的code
+	CreateTime   int64  `json:"create_time"`   // 获取到code的时间戳
+}
+
+// UpdateTemplateCard
+// @Description: 主动更新模板卡片消息
+func UpdateTemplateCard(access_token string, req *UpdateTemplateCardReq) (resp *UpdateTemplateCardResp, err error) {
+	resp = new(UpdateTemplateCardResp)
+	err = PostAPI("/cgi-bin/message/update_template_card", access_token, req, resp)
+	return resp, err
+}
+
+// SaveResponseCode
+// @Description: 保存任务卡片的response_code，发送卡片和收到卡片事件回调时都会得到新的code
+func SaveResponseCode(taskID string, responseCode string) (err error) {
+	if taskID == "" || responseCode == "" {
+		return nil
+	}
+	return StoreSetJSON(responseCodeKeyPrefix+taskID, ResponseCodeRecord{
+		TaskID:       taskID,
+		ResponseCode: responseCode,
+		CreateTime:   time.Now().Unix(),
+	})
+}
+
+// GetResponseCode
+// @Description: 获取任务卡片可用的response_code
+func GetResponseCode(taskID string) (responseCode string, err error) {
+	record := new(ResponseCodeRecord)
+	ok, err := StoreGetJSON(responseCodeKeyPrefix+taskID, record)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", errors.New("response_code not found: " + taskID)
+	}
+	if time.Since(time.Unix(record.CreateTime, 0)) > ResponseCodeTTL {
+		return "", errors.New("response_code expired: " + taskID)
+	}
+	return record.ResponseCode, nil
+}
+
+// SendTemplateCard
+// @Description: 发送模板卡片消息并保存response_code，用于之后主动更新卡片
+func SendTemplateCard(access_token string, msg SendMsgTemplateCardButton) (sendMsgResp *SendMsgResp, err error) {
+	msg.MsgType = "template_card"
+	sendMsgResp, err = SendMsgJSON(access_token, msg)
+	if err != nil {
+		return sendMsgResp, err
+	}
+	if err = SaveResponseCode(msg.TemplateCard.TaskID, sendMsgResp.ResponseCode); err != nil {
+		fmt.Println("save response_code err: ", err)
+	}
+	return sendMsgResp, nil
+}
+
+// UpdateTaskCardButton
+// @Description: 将任务卡片的按钮更新为不可点击状态，userids为空时更新全部接收人
+func UpdateTaskCardButton(access_token string, taskID string, userids []string, replaceName string) (resp *UpdateTemplateCardResp, err error) {
+	req, err := newTaskCardUpdate(taskID, userids)
+	if err != nil {
+		return nil, err
+	}
+	req.Button = &UpdateButtonName{ReplaceName: replaceName}
+	return updateTaskCard(access_token, taskID, req)
+}
+
+// ReplaceTaskCard
+// @Description: 将任务卡片替换为新的卡片，userids为空时替换全部接收人的卡片
+func ReplaceTaskCard(access_token string, taskID string, userids []string, card TemplateCard) (resp *UpdateTemplateCardResp, err error) {
+	req, err := newTaskCardUpdate(taskID, userids)
+	if err != nil {
+		return nil, err
+	}
+	req.TemplateCard = &card
+	return updateTaskCard(access_token, taskID, req)
+}
+
+// 更新任务卡片，成功后response_code已被消费，从存储中删除
+func updateTaskCard(access_token string, taskID string, req *UpdateTemplateCardReq) (resp *UpdateTemplateCardResp, err error) {
+	resp, err = UpdateTemplateCard(access_token, req)
+	if err != nil {
+		return resp, err
+	}
+	Store.Delete(responseCodeKeyPrefix + taskID)
+	return resp, nil
+}
+
+// 构造更新任务卡片的公共参数
+func newTaskCardUpdate(taskID string, userids []string) (req *UpdateTemplateCardReq, err error) {
+	responseCode, err := GetResponseCode(taskID)
+	if err != nil {
+		return nil, err
+	}
+	req = &UpdateTemplateCardReq{
+		UserIDs:      userids,
+		AgentID:      AgentID,
+		ResponseCode: responseCode,
+	}
+	if len(userids) == 0 {
+		req.AtAll = 1
+	}
+	return req, nil
+}
@@ -15,8 +15,11 @@ import (
 // 企业微信回调模板卡片按钮消息体解密后的数据
 type ReqMsgContentTemplateCardButton struct {
 	CallbackMsgContentCommon
-	EventKey string `xml:"EventKey"` // 按钮key值
-	TaskID   string `xml:"TaskId"`   // 任务id
+	Event        string `xml:"Event"`        // 事件类型
+	EventKey     string `xml:"EventKey"`     // 按钮key值
+	TaskID       string `xml:"TaskId"`       // 任务id
+	CardType     string `xml:"CardType"`     // 模板卡片类型
+	ResponseCode string `xml:"ResponseCode"` // 用于主动更新卡片的code
 }
 
 // 企业微信回调文本消息体解密后的数据
@@ -57,6 +60,11 @@ func CallbackTemplateCardButtonTest(c *gin.Context, wxcpt *wxbizmsgcrypt.WXBizMs
 	}
 	fmt.Println("callback unmarshal xml: ", reqMsgContent)
 
+	// 保存最新的response_code，用于之后主动更新卡片
+	if err = SaveResponseCode(reqMsgContent.TaskID, reqMsgContent.ResponseCode); err != nil {
+		fmt.Println("callback save response_code err: ", err)
+	}
+
 	// 业务逻辑处理
 	buttonReplaceText := ""
 	if reqMsgContent.EventKey == "approve" {
@@ -74,6 +74,15 @@ type TemplateCard struct {
 	HorizontalContentList []HorizontalContent `json:"horizontal_content_list"` // 二级标题+文本列表
 	TaskID                string              `json:"task_id"`                 // 任务id
 	ButtonList            []Button            `json:"button_list"`             // 按钮列表
+	CardAction            *CardAction         `json:"card_action,omitempty"`   // 整体卡片的点击跳转事件，文本通知型和图文展示型必填
+}
+
+// 卡片跳转
+type CardAction struct {
+	Type     int    `json:"type"`               // 跳转事件类型，1是url，2是小程序
+	URL      string `json:"url,omitempty"`      // 跳转事件的url
+	AppID    string `json:"appid,omitempty"`    // 跳转事件的小程序的appid
+	PagePath string `json:"pagepath,omitempty"` // 跳转事件的小程序的pagepath
 }
 
 // ***模板卡片消息 end***//
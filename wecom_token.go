@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 提前刷新token的时间，避免使用即将过期的token
+const TokenRefreshAhead = 5 * time.Minute
+
+// 接口未返回有效期时的缓存时长
+const TokenMinTTL = time.Minute
+
+// 缓存的凭证，每个key单独加锁，获取某个凭证时不阻塞其他凭证
+type cachedToken struct {
+	mu       sync.Mutex
+	Token    string
+	ExpireAt time.Time
+	prev     string                                          // 刷新前的凭证，用于识别并发请求中已被刷新的旧凭证
+	fetch    func() (token string, expiresIn int, err error) // 最近一次Get使用的获取函数，Refresh时复用
+}
+
+// 凭证管理，按key缓存access_token等凭证，过期前自动重新获取
+type TokenManager struct {
+	mu     sync.Mutex
+	tokens map[string]*cachedToken
+}
+
+// 全局凭证管理
+var Tokens = NewTokenManager()
+
+func NewTokenManager() *TokenManager {
+	return &TokenManager{tokens: map[string]*cachedToken{}}
+}
+
+// 获取key对应的缓存项，不存在时创建
+func (m *TokenManager) entry(key string) *cachedToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[key]
+	if !ok {
+		t = new(cachedToken)
+		m.tokens[key] = t
+	}
+	return t
+}
+
+// 计算缓存时长，有效期不足TokenRefreshAhead的两倍时缓存一半有效期，避免缓存后立即过期
+func tokenTTL(expiresIn int) time.Duration {
+	lifetime := time.Duration(expiresIn) * time.Second
+	ttl := lifetime - TokenRefreshAhead
+	if ttl < lifetime/2 {
+		ttl = lifetime / 2
+	}
+	if ttl <= 0 {
+		ttl = TokenMinTTL
+	}
+	return ttl
+}
+
+// Get
+// @Description: 获取key对应的凭证，缓存不存在或即将过期时调用fetch重新获取，fetch返回凭证及有效期（秒）
+func (m *TokenManager) Get(key string, fetch func() (token string, expiresIn int, err error)) (token string, err error) {
+	t := m.entry(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fetch = fetch
+	if t.Token != "" && time.Now().Before(t.ExpireAt) {
+		return t.Token, nil
+	}
+	return t.refetch()
+}
+
+// 调用fetch重新获取凭证并写入缓存，调用方需持有t.mu
+func (t *cachedToken) refetch() (token string, err error) {
+	token, expiresIn, err := t.fetch()
+	if err != nil {
+		// key中可能含有凭证相关信息，不打印
+		fmt.Println("token manager fetch err: ", err)
+		return "", err
+	}
+	t.prev, t.Token, t.ExpireAt = t.Token, token, time.Now().Add(tokenTTL(expiresIn))
+	return token, nil
+}
+
+// Set
+// @Description: 写入已获取的凭证，如换取永久授权码时一并返回的access_token
+func (m *TokenManager) Set(key string, token string, expiresIn int) {
+	t := m.entry(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Token, t.ExpireAt = token, time.Now().Add(tokenTTL(expiresIn))
+}
+
+// Invalidate
+// @Description: 使缓存的凭证失效，如应用被取消授权时调用，接口返回token无效或过期由PostAPI、GetAPI调用Refresh处理
+func (m *TokenManager) Invalidate(key string) {
+	t := m.entry(key)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Token, t.ExpireAt = "", time.Time{}
+}
+
+// Refresh
+// @Description: 接口返回token无效或过期时调用，找到缓存该凭证的key并重新获取，
+// 凭证已被其他请求刷新时直接返回新凭证，找不到或无法重新获取时返回false
+func (m *TokenManager) Refresh(token string) (newToken string, ok bool) {
+	if token == "" {
+		return "", false
+	}
+	m.mu.Lock()
+	entries := make([]*cachedToken, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		entries = append(entries, t)
+	}
+	m.mu.Unlock()
+
+	for _, t := range entries {
+		t.mu.Lock()
+		switch {
+		case t.Token == token:
+			t.Token, t.ExpireAt = "", time.Time{}
+			if t.fetch == nil {
+				t.mu.Unlock()
+				return "", false
+			}
+			newToken, err := t.refetch()
+			t.prev = token
+			t.mu.Unlock()
+			return newToken, err == nil
+		case t.prev == token && t.Token != "":
+			newToken = t.Token
+			t.mu.Unlock()
+			return newToken, true
+		}
+		t.mu.Unlock()
+	}
+	return "", false
+}
+
+// GetAccessToken
+// @Description: 获取应用的access_token，带缓存
+func GetAccessToken(corpid, corpsecret string) (access_token string, err error) {
+	// 缓存key使用secret的摘要，避免secret出现在内存快照或日志中
+	sum := sha256.Sum256([]byte(corpsecret))
+	return Tokens.Get("access_token:"+corpid+":"+hex.EncodeToString(sum[:8]), func() (string, int, error) {
+		return getTokenWithExpires(corpid, corpsecret)
+	})
+}
+
+// GetAppAccessToken
+// @Description: 获取当前自建应用的access_token，带缓存
+func GetAppAccessToken() (access_token string, err error) {
+	return GetAccessToken(CorpID, AgentSecret)
+}
+
+// 获取token及有效期
+func getTokenWithExpires(corpid, corpsecret string) (access_token string, expiresIn int, err error) {
+	getTokenResp := new(GetTokenResp)
+	err = GetAPI("/cgi-bin/gettoken", "", url.Values{"corpid": {corpid}, "corpsecret": {corpsecret}}, getTokenResp)
+	if err != nil {
+		return "", 0, err
+	}
+	return getTokenResp.AccessToken, getTokenResp.ExpiresIn, nil
+}
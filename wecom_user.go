@@ -0,0 +1,247 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// ***通讯录成员 start***//
+// 成员信息，创建/更新成员时未设置的字段不会提交
+type User struct {
+	UserID           string           `json:"userid"`                      // 成员UserID
+	Name             string           `json:"name,omitempty"`              // 成员名称
+	Alias            string           `json:"alias,omitempty"`             // 别名
+	Mobile           string           `json:"mobile,omitempty"`            // 手机号码
+	Department       []int            `json:"department,omitempty"`        // 成员所属部门id列表
+	Order            []int            `json:"order,omitempty"`             // 部门内的排序值
+	Position         string           `json:"position,omitempty"`          // 职务信息
+	Gender           string           `json:"gender,omitempty"`            // 性别，1表示男性，2表示女性
+	Email            string           `json:"email,omitempty"`             // 邮箱
+	BizMail          string           `json:"biz_mail,omitempty"`          // 企业邮箱
+	Telephone        string           `json:"telephone,omitempty"`         // 座机
+	IsLeaderInDept   []int            `json:"is_leader_in_dept,omitempty"` // 在所在的部门内是否为部门负责人
+	DirectLeader     []string         `json:"direct_leader,omitempty"`     // 直属上级UserID
+	Avatar           string           `json:"avatar,omitempty"`            // 头像url
+	ThumbAvatar      string           `json:"thumb_avatar,omitempty"`      // 头像缩略图url
+	AvatarMediaID    string           `json:"avatar_mediaid,omitempty"`    // 创建/更新时使用的头像mediaid
+	Status           int              `json:"status,omitempty"`            // 激活状态: 1=已激活，2=已禁用，4=未激活，5=退出企业
+	Enable           *int             `json:"enable,omitempty"`            // 创建/更新时启用/禁用成员，1表示启用，0表示禁用
+	ToInvite         *bool            `json:"to_invite,omitempty"`         // 创建时是否邀请该成员使用企业微信
+	Address          string           `json:"address,omitempty"`           // 地址
+	OpenUserID       string           `json:"open_userid,omitempty"`       // 全局唯一id
+	MainDepartment   int              `json:"main_department,omitempty"`   // 主部门
+	ExtAttr          *UserExtAttr     `json:"extattr,omitempty"`           // 扩展属性
+	QRCode           string           `json:"qr_code,omitempty"`           // 员工个人二维码
+	ExternalPosition string           `json:"external_position,omitempty"` // 对外职务
+	ExternalProfile  *ExternalProfile `json:"external_profile,omitempty"`  // 成员对外属性
+}
+
+// 扩展属性
+type UserExtAttr struct {
+	Attrs []UserAttr `json:"attrs"` // 属性列表
+}
+
+// 成员对外属性
+type ExternalProfile struct {
+	ExternalCorpName string     `json:"external_corp_name,omitempty"` // 对外展示的企业简称
+	ExternalAttr     []UserAttr `json:"external_attr,omitempty"`      // 对外属性列表
+}
+
+// 属性，type为0文本、1网页、2小程序
+type UserAttr struct {
+	Type        int                  `json:"type"`                  // 属性类型
+	Name        string               `json:"name"`                  // 属性名称
+	Text        *UserAttrText        `json:"text,omitempty"`        // 文本类型的属性
+	Web         *UserAttrWeb         `json:"web,omitempty"`         // 网页类型的属性
+	Miniprogram *UserAttrMiniprogram `json:"miniprogram,omitempty"` // 小程序类型的属性
+}
+
+// 文本类型的属性
+type UserAttrText struct {
+	Value string `json:"value"` // 文本属性内容
+}
+
+// 网页类型的属性
+type UserAttrWeb struct {
+	URL   string `json:"url"`   // 网页的url
+	Title string `json:"title"` // 网页的展示标题
+}
+
+// 小程序类型的属性
+type UserAttrMiniprogram struct {
+	AppID    string `json:"appid"`    // 小程序appid
+	PagePath string `json:"pagepath"` // 小程序的页面路径
+	Title    string `json:"title"`    // 小程序的展示标题
+}
+
+// 读取成员响应字段
+type GetUserResp struct {
+	CommonResp
+	User
+}
+
+// 成员列表响应字段
+type UserListResp struct {
+	CommonResp
+	UserList []User `json:"userlist"` // 成员列表
+}
+
+// 批量删除成员请求字段
+type BatchDeleteUserReq struct {
+	UserIDList []string `json:"useridlist"` // 成员UserID列表，最多支持200个
+}
+
+// 获取成员ID列表请求字段
+type ListUserIDReq struct {
+	Cursor string `json:"cursor,omitempty"` // 分页游标，首次请求不填
+	Limit  int    `json:"limit,omitempty"`  // 分页大小，最大10000
+}
+
+// 获取成员ID列表响应字段
+type ListUserIDResp struct {
+	CommonResp
+	NextCursor string     `json:"next_cursor"` // 下一页游标，为空时表示没有更多数据
+	DeptUser   []DeptUser `json:"dept_user"`   // 成员及所属部门
+}
+
+// 成员及所属部门
+type DeptUser struct {
+	UserID     string `json:"userid"`      // 成员UserID
+	OpenUserID string `json:"open_userid"` // 全局唯一id，第三方应用返回
+	Department int    `json:"department"`  // 成员所属部门id
+}
+
+// userid转openid请求字段
+type ConvertToOpenIDReq struct {
+	UserID string `json:"userid"` // 成员UserID
+}
+
+// userid转openid响应字段
+type ConvertToOpenIDResp struct {
+	CommonResp
+	OpenID string `json:"openid"` // 企业微信成员userid对应的openid
+}
+
+// 通过手机号/邮箱获取userid请求字段
+type GetUserIDReq struct {
+	Mobile    string `json:"mobile,omitempty"`     // 手机号
+	Email     string `json:"email,omitempty"`      // 邮箱
+	EmailType int    `json:"email_type,omitempty"` // 邮箱类型：1-企业邮箱（默认）；2-个人邮箱
+}
+
+// 获取userid响应字段
+type GetUserIDResp struct {
+	CommonResp
+	UserID string `json:"userid"` // 成员UserID
+}
+
+// ***通讯录成员 end***//
+
+// GetUser
+// @Description: 读取成员
+func GetUser(access_token string, userid string) (user *User, err error) {
+	resp := new(GetUserResp)
+	err = GetAPI("/cgi-bin/user/get", access_token, url.Values{"userid": {userid}}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return &resp.User, nil
+}
+
+// CreateUser
+// @Description: 创建成员
+func CreateUser(access_token string, user *User) (err error) {
+	return PostAPI("/cgi-bin/user/create", access_token, user, new(CommonResp))
+}
+
+// UpdateUser
+// @Description: 更新成员，仅更新设置了值的字段
+func UpdateUser(access_token string, user *User) (err error) {
+	return PostAPI("/cgi-bin/user/update", access_token, user, new(CommonResp))
+}
+
+// DeleteUser
+// @Description: 删除成员
+func DeleteUser(access_token string, userid string) (err error) {
+	return GetAPI("/cgi-bin/user/delete", access_token, url.Values{"userid": {userid}}, new(CommonResp))
+}
+
+// BatchDeleteUser
+// @Description: 批量删除成员，每次最多200个
+func BatchDeleteUser(access_token string, userids []string) (err error) {
+	return PostAPI("/cgi-bin/user/batchdelete", access_token, BatchDeleteUserReq{UserIDList: userids}, new(CommonResp))
+}
+
+// ListSimpleUser
+// @Description: 获取部门成员（userid、name、department）
+func ListSimpleUser(access_token string, departmentID int, fetchChild bool) (users []User, err error) {
+	return listUser("/cgi-bin/user/simplelist", access_token, departmentID, fetchChild)
+}
+
+// ListUser
+// @Description: 获取部门成员详情
+func ListUser(access_token string, departmentID int, fetchChild bool) (users []User, err error) {
+	return listUser("/cgi-bin/user/list", access_token, departmentID, fetchChild)
+}
+
+func listUser(path string, access_token string, departmentID int, fetchChild bool) (users []User, err error) {
+	params := url.Values{"department_id": {strconv.Itoa(departmentID)}}
+	if fetchChild {
+		params.Set("fetch_child", "1")
+	}
+	resp := new(UserListResp)
+	err = GetAPI(path, access_token, params, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp.UserList, nil
+}
+
+// ListUserID
+// @Description: 分页获取成员ID列表，cursor为空时从第一页开始
+func ListUserID(access_token string, cursor string, limit int) (resp *ListUserIDResp, err error) {
+	resp = new(ListUserIDResp)
+	err = PostAPI("/cgi-bin/user/list_id", access_token, ListUserIDReq{Cursor: cursor, Limit: limit}, resp)
+	return resp, err
+}
+
+// ListAllUserID
+// @Description: 翻页获取全部成员ID列表
+func ListAllUserID(access_token string) (deptUsers []DeptUser, err error) {
+	cursor := ""
+	for {
+		resp, err := ListUserID(access_token, cursor, 10000)
+		if err != nil {
+			return deptUsers, err
+		}
+		deptUsers = append(deptUsers, resp.DeptUser...)
+		if resp.NextCursor == "" {
+			return deptUsers, nil
+		}
+		cursor = resp.NextCursor
+	}
+}
+
+// ConvertToOpenID
+// @Description: userid转openid
+func ConvertToOpenID(access_token string, userid string) (openid string, err error) {
+	resp := new(ConvertToOpenIDResp)
+	err = PostAPI("/cgi-bin/user/convert_to_openid", access_token, ConvertToOpenIDReq{UserID: userid}, resp)
+	return resp.OpenID, err
+}
+
+// GetUserIDByMobile
+// @Description: 手机号获取userid
+func GetUserIDByMobile(access_token string, mobile string) (userid string, err error) {
+	resp := new(GetUserIDResp)
+	err = PostAPI("/cgi-bin/user/getuserid", access_token, GetUserIDReq{Mobile: mobile}, resp)
+	return resp.UserID, err
+}
+
+// GetUserIDByEmail
+// @Description: 邮箱获取userid，emailType为1企业邮箱、2个人邮箱
+func GetUserIDByEmail(access_token string, email string, emailType int) (userid string, err error) {
+	resp := new(GetUserIDResp)
+	err = PostAPI("/cgi-bin/user/get_userid_by_email", access_token, GetUserIDReq{Email: email, EmailType: emailType}, resp)
+	return resp.UserID, err
+}